@@ -0,0 +1,440 @@
+package search_engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token is a term produced by an Analyzer
+type Token struct {
+	Term     string // Text of the token after filtering
+	Position int    // Position in the token stream, tokens at the same position are alternatives
+	Start    int    // Byte offset of the token in the analyzed text
+	End      int    // Byte offset right after the token
+	Derived  bool   // Added by a filter, such as a stem, rather than found in the text
+}
+
+// Tokenizer splits text into tokens
+type Tokenizer interface {
+	Tokenize(text string) []Token
+}
+
+// TokenFilter transforms, removes or adds tokens. Filters keep the positions
+// of the tokens they don't remove, so phrases still see the gaps.
+type TokenFilter interface {
+	Filter(tokens []Token) []Token
+}
+
+// Normalizer is implemented by the filters that only change the characters of
+// terms, such as folding their case. Scoring looks for terms in the content
+// normalized the same way.
+type Normalizer interface {
+	Normalize(text string) string
+}
+
+// Analyzer turns text into the terms that are indexed or searched for.
+// Documents and queries are analyzed the same way so that their terms match.
+type Analyzer interface {
+	Analyze(text string) []Token
+}
+
+// Pipeline is an Analyzer made of a tokenizer followed by a chain of filters
+type Pipeline struct {
+	Tokenizer Tokenizer
+	Filters   []TokenFilter
+}
+
+// NewAnalyzer creates an analyzer that runs the filters, in order, on the
+// tokens of the tokenizer
+func NewAnalyzer(tokenizer Tokenizer, filters ...TokenFilter) *Pipeline {
+	return &Pipeline{Tokenizer: tokenizer, Filters: filters}
+}
+
+// Analyze implements Analyzer
+func (p *Pipeline) Analyze(text string) []Token {
+	tokens := p.Tokenizer.Tokenize(text)
+	for _, filter := range p.Filters {
+		tokens = filter.Filter(tokens)
+	}
+	return tokens
+}
+
+// Normalize implements Normalizer, with the filters that are normalizers
+func (p *Pipeline) Normalize(text string) string {
+	for _, filter := range p.Filters {
+		if n, ok := filter.(Normalizer); ok {
+			text = n.Normalize(text)
+		}
+	}
+	return text
+}
+
+// normalizeText normalizes text like the analyzer normalizes its terms, or
+// folds its case when the analyzer isn't a Normalizer
+func normalizeText(analyzer Analyzer, text string) string {
+	if n, ok := analyzer.(Normalizer); ok {
+		return n.Normalize(text)
+	}
+	return foldCase(text)
+}
+
+// String describes the tokenizer and filters, such as "word|lowercase"
+func (p *Pipeline) String() string {
+	parts := []string{describe(p.Tokenizer)}
+	for _, filter := range p.Filters {
+		parts = append(parts, describe(filter))
+	}
+	return strings.Join(parts, "|")
+}
+
+// describe returns the name of an analysis component
+func describe(v any) string {
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// DefaultAnalyzer returns the analyzer used for documents: lowercased words
+// and their English and Spanish stems
+func DefaultAnalyzer() Analyzer {
+	return analysisSettings{languages: DefaultLanguages}.documentAnalyzer()
+}
+
+// DefaultQueryAnalyzer returns the analyzer used for the words of queries:
+// lowercased words without stop words or single characters, and their English
+// and Spanish stems
+func DefaultQueryAnalyzer() Analyzer {
+	return analysisSettings{languages: DefaultLanguages}.queryAnalyzer()
+}
+
+var defaultAnalyzer = DefaultAnalyzer()
+
+// analyzers holds the analyzers of documents and of query words
+type analyzers struct {
+	document Analyzer
+	query    Analyzer
+
+	// languages are the languages documents and queries are detected in
+	languages []Language
+
+	// documentLanguages and queryLanguages hold the analyzers of documents and
+	// queries in a single language, nil when the analyzer is a custom one
+	documentLanguages map[Language]Analyzer
+	queryLanguages    map[Language]Analyzer
+
+	// synonyms are the synonyms query words expand to, nil for none
+	synonyms *Synonyms
+
+	// fallbackQueries hold the analyzers of queries too short to be detected,
+	// stemmed in all the languages but dropping the stop words of one
+	fallbackQueries map[Language]Analyzer
+
+	// fallback is the language whose stop words queries too short to be
+	// detected drop, the one most of the searched documents are written in,
+	// "" for those of all the languages
+	fallback Language
+}
+
+// withFallback returns the analyzers with the language whose stop words
+// queries too short to be detected drop
+func (a analyzers) withFallback(lang Language) analyzers {
+	a.fallback = lang
+	return a
+}
+
+// defaultAnalyzers are the analyzers used when Options doesn't set any
+var defaultAnalyzers = Options{}.analyzers()
+
+// forDocument returns the analyzer for the content of a document and the
+// language the document is written in
+func (a analyzers) forDocument(content string) (Analyzer, Language) {
+	lang := documentLanguage(content, a.languages)
+	return a.forLanguage(lang), lang
+}
+
+// forLanguage returns the analyzer of documents written in a language, or the
+// one of all the languages when the language is unknown
+func (a analyzers) forLanguage(lang Language) Analyzer {
+	if analyzer, ok := a.documentLanguages[lang]; ok {
+		return analyzer
+	}
+	return a.document
+}
+
+// forQuery returns the analyzers for a query and the language it is detected
+// to be written in. A query too short to tell, such as la api, keeps all the
+// stemmers but only drops the stop words of the fallback language.
+func (a analyzers) forQuery(query string) (analyzers, Language) {
+	lang := detectLanguage(query, a.languages)
+	if analyzer, ok := a.queryLanguages[lang]; ok {
+		a.query = analyzer
+	} else if analyzer, ok := a.fallbackQueries[a.fallback]; ok {
+		a.query = analyzer
+	}
+	return a, lang
+}
+
+// newDocument creates and analyzes a document with the analyzer of its language
+func (a analyzers) newDocument(path, content string) *Document {
+	analyzer, lang := a.forDocument(content)
+	doc := analyzeDocument(path, content, analyzer)
+	doc.Language = lang
+	return doc
+}
+
+// analyzeTerms returns the terms of the tokens of a text, in order
+func analyzeTerms(analyzer Analyzer, text string) []string {
+	tokens := analyzer.Analyze(text)
+	terms := make([]string, len(tokens))
+	for i, tok := range tokens {
+		terms[i] = tok.Term
+	}
+	return terms
+}
+
+// literalTerms returns the terms found in a text itself, without the derived
+// ones such as stems
+func literalTerms(analyzer Analyzer, text string) []string {
+	var terms []string
+	for _, tok := range analyzer.Analyze(text) {
+		if !tok.Derived {
+			terms = append(terms, tok.Term)
+		}
+	}
+	return terms
+}
+
+// analyzeWords returns the first term at every position of a text: the words
+// as the analyzer splits them, without stems or other alternatives
+func analyzeWords(analyzer Analyzer, text string) []string {
+	var words []string
+	last := -1
+	for _, tok := range analyzer.Analyze(text) {
+		if tok.Position != last {
+			words = append(words, tok.Term)
+			last = tok.Position
+		}
+	}
+	return words
+}
+
+// wordDictionaryOf returns the sorted unique words of a text, without stems
+func wordDictionaryOf(analyzer Analyzer, text string) []string {
+	return sortedUnique(literalTerms(analyzer, text))
+}
+
+// sortedUnique returns the distinct terms in sorted order
+func sortedUnique(terms []string) []string {
+	seen := make(map[string]bool)
+	var dictionary []string
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			dictionary = append(dictionary, term)
+		}
+	}
+	sort.Strings(dictionary)
+	return dictionary
+}
+
+// WordTokenizer splits text into runs of letters and digits. Everything else,
+// including punctuation inside words such as x-api-key, separates tokens.
+type WordTokenizer struct{}
+
+func (WordTokenizer) String() string { return "word" }
+
+// Tokenize implements Tokenizer
+func (WordTokenizer) Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, Token{
+				Term:     text[start:end],
+				Position: len(tokens),
+				Start:    start,
+				End:      end,
+			})
+			start = -1
+		}
+	}
+
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(text))
+
+	return tokens
+}
+
+// LowercaseFilter folds the case of every token with Unicode case folding
+type LowercaseFilter struct{}
+
+func (LowercaseFilter) String() string { return "lowercase" }
+
+// Filter implements TokenFilter
+func (LowercaseFilter) Filter(tokens []Token) []Token {
+	for i := range tokens {
+		tokens[i].Term = foldCase(tokens[i].Term)
+	}
+	return tokens
+}
+
+// Normalize implements Normalizer
+func (LowercaseFilter) Normalize(text string) string { return foldCase(text) }
+
+// foldCase folds the case of text with the simple case folding of Unicode, so
+// that letters such as Σ, σ and ς, or K and the Kelvin sign, compare equal
+func foldCase(text string) string {
+	return strings.Map(func(r rune) rune { return unicode.ToLower(unicode.ToUpper(r)) }, text)
+}
+
+// StopWordFilter removes the tokens that are stop words
+type StopWordFilter struct {
+	Words map[string]bool
+}
+
+func (f StopWordFilter) String() string {
+	words := make([]string, 0, len(f.Words))
+	for word := range f.Words {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return "stop(" + strings.Join(words, ",") + ")"
+}
+
+// Filter implements TokenFilter
+func (f StopWordFilter) Filter(tokens []Token) []Token {
+	kept := tokens[:0]
+	for _, tok := range tokens {
+		if !f.Words[tok.Term] {
+			kept = append(kept, tok)
+		}
+	}
+	return kept
+}
+
+// LengthFilter removes the tokens shorter than Min characters
+type LengthFilter struct {
+	Min int
+}
+
+func (f LengthFilter) String() string { return fmt.Sprintf("length(%d)", f.Min) }
+
+// Filter implements TokenFilter
+func (f LengthFilter) Filter(tokens []Token) []Token {
+	kept := tokens[:0]
+	for _, tok := range tokens {
+		if utf8.RuneCountInString(tok.Term) >= f.Min {
+			kept = append(kept, tok)
+		}
+	}
+	return kept
+}
+
+// VariationFilter keeps every token and adds its variations without a plural
+// s or an -ing or -ed suffix at the same position
+type VariationFilter struct{}
+
+func (VariationFilter) String() string {
+	return "variations(" + strings.Join(termVariationRules, ",") + ")"
+}
+
+// Filter implements TokenFilter
+func (VariationFilter) Filter(tokens []Token) []Token {
+	var result []Token
+	for _, tok := range tokens {
+		result = append(result, tok)
+		for _, variation := range generateTermVariations(tok.Term) {
+			alt := tok
+			alt.Term = variation
+			result = append(result, alt)
+		}
+	}
+	return result
+}
+
+// ASCIIFoldingFilter replaces accented Latin letters with their ASCII
+// equivalents, such as é with e and ß with ss, and drops combining accents.
+// Terms that become equal at the same position, such as a word and its stem,
+// are kept once.
+type ASCIIFoldingFilter struct{}
+
+func (ASCIIFoldingFilter) String() string { return "asciifolding" }
+
+// Filter implements TokenFilter
+func (ASCIIFoldingFilter) Filter(tokens []Token) []Token {
+	var result []Token
+	seen := make(map[string]bool)
+	for i, tok := range tokens {
+		if i > 0 && tok.Position != tokens[i-1].Position {
+			clear(seen)
+		}
+		tok.Term = foldASCII(tok.Term)
+		if !seen[tok.Term] {
+			seen[tok.Term] = true
+			result = append(result, tok)
+		}
+	}
+	return result
+}
+
+// Normalize implements Normalizer
+func (ASCIIFoldingFilter) Normalize(text string) string { return foldASCII(text) }
+
+// asciiFolding maps accented Latin letters to ASCII
+var asciiFolding = func() map[rune]string {
+	groups := map[string]string{
+		"a": "àáâãäåāăą", "A": "ÀÁÂÃÄÅĀĂĄ",
+		"c": "çćĉċč", "C": "ÇĆĈĊČ",
+		"d": "ďđ", "D": "ĎĐ",
+		"e": "èéêëēĕėęě", "E": "ÈÉÊËĒĔĖĘĚ",
+		"g": "ĝğġģ", "G": "ĜĞĠĢ",
+		"i": "ìíîïĩīĭįı", "I": "ÌÍÎÏĨĪĬĮİ",
+		"l": "ĺļľŀł", "L": "ĹĻĽĿŁ",
+		"n": "ñńņňŉ", "N": "ÑŃŅŇ",
+		"o": "òóôõöøōŏő", "O": "ÒÓÔÕÖØŌŎŐ",
+		"r": "ŕŗř", "R": "ŔŖŘ",
+		"s": "śŝşš", "S": "ŚŜŞŠ",
+		"t": "ţťŧ", "T": "ŢŤŦ",
+		"u": "ùúûüũūŭůűų", "U": "ÙÚÛÜŨŪŬŮŰŲ",
+		"y": "ýÿŷ", "Y": "ÝŸŶ",
+		"z": "źżž", "Z": "ŹŻŽ",
+		"ss": "ß", "ae": "æ", "AE": "Æ", "oe": "œ", "OE": "Œ",
+	}
+
+	folding := make(map[rune]string)
+	for ascii, letters := range groups {
+		for _, r := range letters {
+			folding[r] = ascii
+		}
+	}
+	return folding
+}()
+
+// foldASCII replaces the accented Latin letters of s and drops combining accents
+func foldASCII(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if ascii, ok := asciiFolding[r]; ok {
+			b.WriteString(ascii)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
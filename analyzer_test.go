@@ -0,0 +1,279 @@
+package search_engine
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAnalyzer_Tokens(t *testing.T) {
+	tokens := DefaultQueryAnalyzer().Analyze("The API-Keys, testing")
+
+	expected := []Token{
+		{Term: "api", Position: 1, Start: 4, End: 7},
+		{Term: "api-keys", Position: 1, Start: 4, End: 12},
+		{Term: "api-key", Position: 1, Start: 4, End: 12, Derived: true},
+		{Term: "keys", Position: 2, Start: 8, End: 12},
+		{Term: "key", Position: 2, Start: 8, End: 12, Derived: true},
+		{Term: "testing", Position: 3, Start: 14, End: 21},
+		{Term: "test", Position: 3, Start: 14, End: 21, Derived: true},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Analyze() = %+v, expected %+v", tokens, expected)
+	}
+}
+
+func TestAnalyzer_Filters(t *testing.T) {
+	tests := []struct {
+		name     string
+		analyzer Analyzer
+		text     string
+		expected []string
+	}{
+		{"Default", DefaultAnalyzer(), "GET /api/Vouchers", []string{"get", "api", "vouchers", "voucher"}},
+		{"Stop words", NewAnalyzer(WordTokenizer{}, StopWordFilter{Words: map[string]bool{"of": true}}), "list of items", []string{"list", "items"}},
+		{"Length", NewAnalyzer(WordTokenizer{}, LengthFilter{Min: 3}), "a to api", []string{"api"}},
+		{"ASCII folding", NewAnalyzer(WordTokenizer{}, ASCIIFoldingFilter{}), "creación", []string{"creacion"}},
+		{"Folding ligatures", NewAnalyzer(wholeTextTokenizer{}, ASCIIFoldingFilter{}), "straße", []string{"strasse"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := analyzeTerms(tt.analyzer, tt.text); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Analyze(%q) = %v, expected %v", tt.text, got, tt.expected)
+			}
+		})
+	}
+}
+
+// wholeTextTokenizer returns the whole text as a single token
+type wholeTextTokenizer struct{}
+
+func (wholeTextTokenizer) Tokenize(text string) []Token {
+	return []Token{{Term: text, End: len(text)}}
+}
+
+func TestWordTokenizer_Unicode(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"autenticación y código", []string{"autenticación", "y", "código"}},
+		// A decomposed ó is an o followed by a combining accent
+		{"co\u0301digo", []string{"co\u0301digo"}},
+		{"Ошибка: токен", []string{"Ошибка", "токен"}},
+	}
+
+	for _, tt := range tests {
+		if got := analyzeTerms(NewAnalyzer(WordTokenizer{}), tt.text); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Tokenize(%q) = %v, expected %v", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestFoldCase(t *testing.T) {
+	if a, b := foldCase("ΣΊΣΥΦΟΣ"), foldCase("σίσυφος"); a != b {
+		t.Errorf("foldCase() = %q and %q, expected the same", a, b)
+	}
+	if got := foldCase("\u212Aelvin"); got != "kelvin" {
+		t.Errorf("foldCase(Kelvin sign) = %q", got)
+	}
+}
+
+func TestASCIIFoldingFilter(t *testing.T) {
+	analyzer := NewAnalyzer(WordTokenizer{}, LowercaseFilter{}, StemFilter{Stemmers: []Stemmer{SpanishStemmer{}}}, ASCIIFoldingFilter{})
+
+	// The stem of está is esta, folded into the same term as the word
+	if got, expected := analyzeTerms(analyzer, "Código está"), []string{"codigo", "codig", "esta"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Analyze() = %v, expected %v", got, expected)
+	}
+	if got := normalizeText(analyzer, "Código\nCo\u0301digo"); got != "codigo\ncodigo" {
+		t.Errorf("Normalize() = %q", got)
+	}
+}
+
+func TestOptions_FoldAccents(t *testing.T) {
+	testFS := fstest.MapFS{
+		"auth.md":  &fstest.MapFile{Data: []byte("# Autenticación\n\nEnvía el código de autenticación en la cabecera.")},
+		"other.md": &fstest.MapFile{Data: []byte("# Webhooks\n\nLos eventos se envían a tu servidor.")},
+	}
+	opts := Options{FoldAccents: true}
+
+	indexed, err := NewIndexedSearchEngineWithOptions(testFS, opts)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngineWithOptions() error = %v", err)
+	}
+
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngineWithOptions(testFS, opts), "index": indexed} {
+		results, err := engine.FindRelevantFiles("codigo autenticacion", 10)
+		if err != nil {
+			t.Fatalf("FindRelevantFiles() error = %v", err)
+		}
+		if len(results) != 1 || results[0].Path != "auth.md" || strings.Contains(results[0].Reason, "fuzzy") {
+			t.Errorf("%s: FindRelevantFiles() = %v, expected an exact match of auth.md", name, results)
+		}
+
+		content, err := engine.ExtractRelevantContent("auth.md", "codigo", 0)
+		if err != nil {
+			t.Fatalf("ExtractRelevantContent() error = %v", err)
+		}
+		if !strings.Contains(content, "Envía el código") {
+			t.Errorf("%s: ExtractRelevantContent() = %q", name, content)
+		}
+	}
+}
+
+func TestFindRelevantFiles_FoldAccentsInPaths(t *testing.T) {
+	testFS := fstest.MapFS{
+		"Código/intro.md":  &fstest.MapFile{Data: []byte("# Intro\n\nHola.")},
+		"autenticación.md": &fstest.MapFile{Data: []byte("# Tokens\n\nEnvía el token.")},
+	}
+	opts := Options{FoldAccents: true}
+
+	indexed, err := NewIndexedSearchEngineWithOptions(testFS, opts)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngineWithOptions() error = %v", err)
+	}
+
+	tests := []struct {
+		query  string
+		path   string
+		reason string
+	}{
+		{"codigo", "Código/intro.md", "directory exact match 'codigo'"},
+		{"código", "Código/intro.md", "directory exact match 'codigo'"},
+		{"autenticacion", "autenticación.md", "exact filename match"},
+	}
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngineWithOptions(testFS, opts), "index": indexed} {
+		for _, tt := range tests {
+			results, err := engine.FindRelevantFiles(tt.query, 10)
+			if err != nil {
+				t.Fatalf("FindRelevantFiles() error = %v", err)
+			}
+			if len(results) != 1 || results[0].Path != tt.path || !strings.Contains(results[0].Reason, tt.reason) {
+				t.Errorf("%s: FindRelevantFiles(%q) = %v, expected %s for %s", name, tt.query, results, tt.path, tt.reason)
+			}
+		}
+	}
+}
+
+func TestAnalyzer_String(t *testing.T) {
+	analyzer := NewAnalyzer(WordTokenizer{}, LowercaseFilter{}, LengthFilter{Min: 2})
+	if got := analyzer.String(); got != "word|lowercase|length(2)" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestParseQuery_CompoundWord(t *testing.T) {
+	q, err := ParseQuery("+x-api-key")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	phrase, ok := q.Root.(*BoolNode).Must[0].(*PhraseNode)
+	if !ok {
+		t.Fatalf("Root = %s, expected a phrase", q)
+	}
+	if !reflect.DeepEqual(phrase.Words, []string{"x", "api", "key"}) {
+		t.Errorf("Words = %v", phrase.Words)
+	}
+	if expected := []string{"x api key", "x-api-key", "api", "key"}; !reflect.DeepEqual(q.Terms(), expected) {
+		t.Errorf("Terms() = %v, expected %v", q.Terms(), expected)
+	}
+}
+
+func TestFindRelevantFiles_AnalyzedTheSameWay(t *testing.T) {
+	testFS := fstest.MapFS{
+		"headers.md": &fstest.MapFile{Data: []byte("Send the X-API-Key header")},
+		"keys.md":    &fstest.MapFile{Data: []byte("An API returns a key")},
+	}
+
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngine(testFS), "index": indexed} {
+		t.Run(name, func(t *testing.T) {
+			results, err := engine.FindRelevantFiles("+x_api_key", 10)
+			if err != nil {
+				t.Fatalf("FindRelevantFiles() error = %v", err)
+			}
+			if len(results) != 1 || results[0].Path != "headers.md" {
+				t.Errorf("FindRelevantFiles() = %v, expected only headers.md", results)
+			}
+
+			content, err := engine.ExtractRelevantContent("headers.md", "header", 0)
+			if err != nil {
+				t.Fatalf("ExtractRelevantContent() error = %v", err)
+			}
+			if content != "Send the X-API-Key header" {
+				t.Errorf("ExtractRelevantContent() = %q", content)
+			}
+		})
+	}
+}
+
+func TestOptions_QueryAnalyzer(t *testing.T) {
+	testFS := fstest.MapFS{
+		"voucher.md": &fstest.MapFile{Data: []byte("A voucher")},
+	}
+
+	// Without variations, vouchers only finds voucher as a typo
+	exact := NewAnalyzer(WordTokenizer{}, LowercaseFilter{})
+	for _, tt := range []struct {
+		opts  Options
+		fuzzy bool
+	}{
+		{Options{Scorer: NewBM25Scorer()}, false},
+		{Options{Scorer: NewBM25Scorer(), QueryAnalyzer: exact}, true},
+	} {
+		results, err := NewSearchEngineWithOptions(testFS, tt.opts).FindRelevantFiles("vouchers", 10)
+		if err != nil {
+			t.Fatalf("FindRelevantFiles() error = %v", err)
+		}
+		if len(results) != 1 || strings.Contains(results[0].Reason, "fuzzy") != tt.fuzzy {
+			t.Errorf("FindRelevantFiles() = %v, expected a fuzzy match: %v", results, tt.fuzzy)
+		}
+	}
+}
+
+func TestIndex_CustomAnalyzerSettings(t *testing.T) {
+	testFS := fstest.MapFS{
+		"guide.md": &fstest.MapFile{Data: []byte("Guide")},
+	}
+	analyzer := NewAnalyzer(WordTokenizer{}, LowercaseFilter{}, ASCIIFoldingFilter{})
+	idx, err := BuildIndexWithOptions(testFS, Options{Analyzer: analyzer})
+	if err != nil {
+		t.Fatalf("BuildIndexWithOptions() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := idx.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	data := buf.Bytes()
+	if _, err := ReadIndex(bytes.NewReader(data)); !errors.Is(err, ErrIndexSettings) {
+		t.Errorf("ReadIndex() error = %v, expected ErrIndexSettings", err)
+	}
+	if _, err := NewIndexedSearchEngineFromIndexWithOptions(testFS, idx, Options{}); !errors.Is(err, ErrIndexSettings) {
+		t.Errorf("NewIndexedSearchEngineFromIndexWithOptions() error = %v, expected ErrIndexSettings", err)
+	}
+
+	// Given the same analyzer, the index round-trips
+	opts := Options{Analyzer: NewAnalyzer(WordTokenizer{}, LowercaseFilter{}, ASCIIFoldingFilter{})}
+	loaded, err := ReadIndexWithOptions(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatalf("ReadIndexWithOptions() error = %v", err)
+	}
+	engine, err := NewIndexedSearchEngineFromIndexWithOptions(testFS, loaded, opts)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngineFromIndexWithOptions() error = %v", err)
+	}
+	if results, err := engine.FindRelevantFiles("guide", 10); err != nil || len(results) != 1 {
+		t.Errorf("FindRelevantFiles() = %v, %v, expected guide.md", results, err)
+	}
+}
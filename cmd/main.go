@@ -1,29 +1,64 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
-	"sort"
 	"strings"
 	search_engine "textSearch"
+	"time"
 )
 
 func main() {
 	// Define command line flags
-	contextLines := flag.Int("context", 10, "Number of context lines to show around matches")
+	contextLines := flag.Int("context", 10, "Target number of context lines to show around matches; code blocks, tables and list items are kept whole")
+	indexFile := flag.String("index", "", "Load the index from this file instead of indexing the directory")
+	saveIndex := flag.String("save-index", "", "Index the directory, write the index to this file and exit")
+	scorerName := flag.String("scorer", "heuristic", "Ranking model: heuristic or bm25")
+	k1 := flag.Float64("k1", 1.2, "BM25 term frequency saturation")
+	b := flag.Float64("b", 0.75, "BM25 length normalization (0-1)")
+	boostSpec := flag.String("boost", "", "Field weights such as title=3,heading=2,code=0.5 (fields: path, filename, title, heading, body, code, table)")
+	maxExpansions := flag.Int("max-expansions", search_engine.DefaultMaxExpansions, "Maximum terms each wildcard or fuzzy term expands to")
+	regexMode := flag.Bool("regex", false, "Treat the whole query as a regular expression")
+	sectionsMode := flag.Bool("sections", false, "Print the best matching sections of all files instead of files")
+	maxTokens := flag.Int("max-tokens", 0, "Print the most relevant sections of all files that fit in this many tokens, for a language model")
+	highlightName := flag.String("highlight", "auto", "Mark the words matching the query: ansi, markdown, none or auto (ansi on a terminal)")
+	langSpec := flag.String("lang", "en,es", "Languages documents and queries are detected in, comma separated (en, es)")
+	foldAccents := flag.Bool("fold-accents", false, "Fold accents in documents and queries, so that codigo matches código")
+	stopWordsSpec := flag.String("stopwords", "", "Stop words dropped from queries: english, spanish, none, a comma separated combination or a file (default: by query language)")
+	synonymsFile := flag.String("synonyms", "", "Synonym file (text, or YAML with a .yaml extension) that query words expand to")
+	watchMode := flag.Bool("watch", false, "Keep the index in sync with the directory and answer queries read from standard input")
+	interval := flag.Duration("interval", search_engine.DefaultWatchInterval, "How often watch mode checks the directory for changes")
 	flag.Parse()
 
 	args := flag.Args()
-	if len(args) < 1 {
+	if len(args) < 1 && *saveIndex == "" && !*watchMode {
 		fmt.Println("Usage: search [options] <query>")
+		fmt.Println("       search [options] -watch")
 		fmt.Println("Options:")
-		fmt.Println("  -context int   Number of context lines (default 10)")
+		fmt.Println("  -context int         Target number of context lines, whole blocks are kept (default 10)")
+		fmt.Println("  -index file          Load a prebuilt index instead of indexing the directory")
+		fmt.Println("  -save-index file     Write the index of the directory to file and exit")
+		fmt.Println("  -watch               Keep the index in sync and answer queries read from standard input")
+		fmt.Println("  -interval duration   How often watch mode checks for changes (default 1s)")
+		fmt.Println("  -scorer name         Ranking model: heuristic or bm25 (default heuristic)")
+		fmt.Println("  -k1 float            BM25 term frequency saturation (default 1.2)")
+		fmt.Println("  -b float             BM25 length normalization (default 0.75)")
+		fmt.Println("  -boost list          Field weights, e.g. title=3,heading=2,code=0.5")
+		fmt.Println("  -max-expansions int  Terms each wildcard or fuzzy term expands to (default 50)")
+		fmt.Println("  -regex               Treat the whole query as a regular expression")
+		fmt.Println("  -sections            Print the best matching sections instead of files")
+		fmt.Println("  -max-tokens int      Print the most relevant sections that fit in this many tokens")
+		fmt.Println("  -highlight style     Mark matching words: ansi, markdown, none or auto (default auto)")
+		fmt.Println("  -lang list           Languages to detect and stem, e.g. en or en,es (default en,es)")
+		fmt.Println("  -fold-accents        Fold accents, so that codigo matches código")
+		fmt.Println("  -stopwords list      Drop these stop words from queries: english, spanish, none or a file")
+		fmt.Println("  -synonyms file       Expand query words with the synonyms of a text or YAML file")
 		os.Exit(1)
 	}
 
-	query := args[0]
-
 	// Get current working directory
 	searchPath, err := os.Getwd()
 	if err != nil {
@@ -40,68 +75,111 @@ func main() {
 	// Create filesystem for kbase directory
 	kbaseFS := os.DirFS(searchPath)
 
-	// Create search engine
-	engine := search_engine.NewSearchEngine(kbaseFS)
-
-	// Check if query contains pipe-separated terms
-	var allResults []search_engine.FileMatch
-	fileScores := make(map[string]search_engine.FileMatch)
-
-	if strings.Contains(query, "|") {
-		// Split by pipe and search for each term
-		terms := strings.Split(query, "|")
-		for _, term := range terms {
-			term = strings.TrimSpace(term)
-			if term == "" {
-				continue
-			}
-
-			// Search for this term
-			results, err := engine.FindRelevantFiles(term, 10)
-			if err != nil {
-				fmt.Printf("Search error for term '%s': %v\n", term, err)
-				continue
-			}
+	languages, err := search_engine.ParseLanguages(*langSpec)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
-			// Merge results, keeping highest score for each file
-			for _, result := range results {
-				if existing, ok := fileScores[result.Path]; !ok || result.Score > existing.Score {
-					// Update reason to include which term matched
-					if existing.Reason != "" && ok {
-						result.Reason = fmt.Sprintf("matched terms: %s, %s", term, existing.Reason)
-					} else {
-						result.Reason = fmt.Sprintf("matched term: %s (%s)", term, result.Reason)
-					}
-					fileScores[result.Path] = result
-				}
-			}
+	// Index the directory once so that every term of the query is answered from memory
+	indexOpts := search_engine.Options{Languages: languages, FoldAccents: *foldAccents}
+	index := loadIndex(*indexFile, indexOpts)
+	if index == nil {
+		index, err = search_engine.BuildIndexWithOptions(kbaseFS, indexOpts)
+		if err != nil {
+			fmt.Printf("Error indexing %s: %v\n", searchPath, err)
+			os.Exit(1)
 		}
+	}
 
-		// Convert map to slice and sort by score
-		for _, match := range fileScores {
-			allResults = append(allResults, match)
+	if *saveIndex != "" {
+		if err := index.Save(*saveIndex); err != nil {
+			fmt.Printf("Error saving index: %v\n", err)
+			os.Exit(1)
 		}
+		fmt.Printf("Indexed %d files into %s\n", index.Len(), *saveIndex)
+		return
+	}
 
-		// Sort by score descending
-		sort.Slice(allResults, func(i, j int) bool {
-			return allResults[i].Score > allResults[j].Score
-		})
-
-		// Limit to top 10
-		if len(allResults) > 10 {
-			allResults = allResults[:10]
+	scorer, err := search_engine.ScorerByName(*scorerName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	boosts, err := search_engine.ParseFieldBoosts(*boostSpec)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	switch s := scorer.(type) {
+	case *search_engine.HeuristicScorer:
+		s.Boosts = boosts
+	case *search_engine.BM25Scorer:
+		s.K1 = *k1
+		s.B = *b
+		s.Boosts = boosts
+	}
+	highlight, err := highlightStyle(*highlightName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts := search_engine.Options{
+		Scorer:        scorer,
+		MaxExpansions: *maxExpansions,
+		Languages:     languages,
+		FoldAccents:   *foldAccents,
+		Highlight:     highlight,
+	}
+	if *stopWordsSpec != "" {
+		opts.StopWords, err = search_engine.ParseStopWords(*stopWordsSpec)
+		if err != nil {
+			fmt.Printf("Error loading stop words: %v\n", err)
+			os.Exit(1)
 		}
-	} else {
-		// Single term search
-		var err error
-		allResults, err = engine.FindRelevantFiles(query, 10)
+	}
+	if *synonymsFile != "" {
+		opts.Synonyms, err = search_engine.LoadSynonyms(*synonymsFile)
 		if err != nil {
-			fmt.Printf("Search error: %v\n", err)
+			fmt.Printf("Error loading synonyms: %v\n", err)
 			os.Exit(1)
 		}
 	}
 
-	results := allResults
+	engine, err := search_engine.NewIndexedSearchEngineFromIndexWithOptions(kbaseFS, index, opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *watchMode {
+		runWatch(kbaseFS, engine, *interval, *contextLines, *maxTokens, *regexMode, *sectionsMode)
+		return
+	}
+
+	if *maxTokens > 0 {
+		runContextQuery(engine, args[0], *maxTokens, *regexMode)
+		return
+	}
+	if *sectionsMode {
+		runSectionQuery(engine, args[0], *regexMode)
+		return
+	}
+	runQuery(engine, args[0], *contextLines, *regexMode)
+}
+
+// runQuery searches the engine and prints the results with their relevant content
+func runQuery(engine search_engine.SearchEngine, query string, contextLines int, regex bool) {
+	if regex {
+		query = search_engine.RegexQuery(query)
+	}
+
+	// Pipe-separated terms and the other operators are handled by the query parser
+	results, err := engine.FindRelevantFiles(query, 10)
+	if err != nil {
+		fmt.Printf("Search error: %v\n", err)
+		return
+	}
 
 	// Display results
 	if len(results) == 0 {
@@ -118,12 +196,15 @@ func main() {
 		// Print file info
 		fmt.Printf("📁 Path: %s\n", result.Path)
 		fmt.Printf("📊 Score: %.2f\n", result.Score)
+		if result.Language != "" {
+			fmt.Printf("🌐 Language: %s\n", result.Language)
+		}
 		if result.Reason != "" {
 			fmt.Printf("💡 Reason: %s\n", result.Reason)
 		}
 
 		// Extract and show relevant content
-		content, err := engine.ExtractRelevantContent(result.Path, query, *contextLines)
+		content, err := engine.ExtractRelevantContent(result.Path, query, contextLines)
 		if err == nil && len(content) > 0 {
 			fmt.Println("\n📝 Relevant content:")
 			fmt.Println(strings.Repeat("─", 80))
@@ -136,3 +217,136 @@ func main() {
 	// Final separator
 	fmt.Println(strings.Repeat("═", 80))
 }
+
+// runSectionQuery searches the sections of all files and prints each with its content
+func runSectionQuery(engine search_engine.SearchEngine, query string, regex bool) {
+	if regex {
+		query = search_engine.RegexQuery(query)
+	}
+
+	results, err := engine.SearchSections(query, 10)
+	if err != nil {
+		fmt.Printf("Search error: %v\n", err)
+		return
+	}
+
+	if len(results) == 0 {
+		fmt.Printf("No sections found for '%s'\n", query)
+		return
+	}
+
+	fmt.Printf("Found %d sections for '%s':\n\n", len(results), query)
+
+	for _, result := range results {
+		fmt.Println(strings.Repeat("═", 80))
+
+		fmt.Printf("📍 Section: %s\n", result.Location())
+		fmt.Printf("📄 Lines: %d-%d\n", result.LineStart, result.LineEnd)
+		fmt.Printf("📊 Score: %.2f\n", result.Score)
+		if result.Language != "" {
+			fmt.Printf("🌐 Language: %s\n", result.Language)
+		}
+		if result.Reason != "" {
+			fmt.Printf("💡 Reason: %s\n", result.Reason)
+		}
+
+		content, err := engine.GetFileContent(result.Path)
+		if err == nil {
+			lines := strings.Split(content, "\n")
+			if result.LineEnd <= len(lines) {
+				fmt.Println("\n📝 Content:")
+				fmt.Println(strings.Repeat("─", 80))
+				fmt.Println(strings.Join(lines[result.LineStart-1:result.LineEnd], "\n"))
+				fmt.Println(strings.Repeat("─", 80))
+			}
+		}
+		fmt.Println()
+	}
+
+	fmt.Println(strings.Repeat("═", 80))
+}
+
+// runContextQuery packs the sections most relevant to the query into a token
+// budget and prints them, with a summary on standard error
+func runContextQuery(engine search_engine.SearchEngine, query string, maxTokens int, regex bool) {
+	if regex {
+		query = search_engine.RegexQuery(query)
+	}
+
+	packed, err := engine.BuildContext(query, maxTokens)
+	if err != nil {
+		fmt.Printf("Search error: %v\n", err)
+		return
+	}
+
+	if len(packed.Sections) == 0 {
+		fmt.Printf("No sections found for '%s'\n", query)
+		return
+	}
+
+	fmt.Print(packed.String())
+	fmt.Fprintf(os.Stderr, "Packed %d sections in %d of %d tokens, %d left out\n",
+		len(packed.Sections), packed.Tokens, packed.MaxTokens, packed.Omitted)
+}
+
+// runWatch keeps the index in sync with the directory and answers queries read
+// from standard input, one per line, until end of input
+func runWatch(kbaseFS fs.FS, engine *search_engine.IndexedSearchEngine, interval time.Duration, contextLines, maxTokens int, regex, sections bool) {
+	watcher := search_engine.NewWatcher(kbaseFS, engine.Index(), interval)
+	watcher.OnUpdate = func(update search_engine.IndexUpdate) {
+		fmt.Fprintf(os.Stderr, "Index updated: %d added, %d modified, %d removed\n",
+			len(update.Added), len(update.Modified), len(update.Removed))
+	}
+	watcher.OnError = func(err error) {
+		fmt.Fprintf(os.Stderr, "Watch error: %v\n", err)
+	}
+	watcher.Start()
+	defer watcher.Stop()
+
+	fmt.Fprintf(os.Stderr, "Watching %d files, enter a query per line (Ctrl-D to quit)\n", engine.Index().Len())
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		query := strings.TrimSpace(scanner.Text())
+		if query == "" {
+			continue
+		}
+		if maxTokens > 0 {
+			runContextQuery(engine, query, maxTokens, regex)
+			continue
+		}
+		if sections {
+			runSectionQuery(engine, query, regex)
+			continue
+		}
+		runQuery(engine, query, contextLines, regex)
+	}
+}
+
+// highlightStyle returns the highlight style with the given name. auto colors
+// matches when standard output is a terminal and leaves them unmarked otherwise.
+func highlightStyle(name string) (search_engine.HighlightStyle, error) {
+	if name != "auto" {
+		return search_engine.ParseHighlightStyle(name)
+	}
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		return search_engine.HighlightANSI, nil
+	}
+	return search_engine.HighlightNone, nil
+}
+
+// loadIndex loads a prebuilt index built with the options. It returns nil when
+// no file is given or the file can't be used, in which case the directory is
+// indexed instead.
+func loadIndex(path string, opts search_engine.Options) *search_engine.Index {
+	if path == "" {
+		return nil
+	}
+
+	index, err := search_engine.LoadIndexWithOptions(path, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring index %s: %v\n", path, err)
+		return nil
+	}
+	return index
+}
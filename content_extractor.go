@@ -1,20 +1,33 @@
 package search_engine
 
 import (
+	"fmt"
 	"io/fs"
-	"regexp"
 	"sort"
 	"strings"
 )
 
 // ContentExtractor handles extracting relevant content from files
 type ContentExtractor struct {
-	fs fs.FS
+	fs            fs.FS
+	maxExpansions int
+	analyzers     analyzers
+	highlight     HighlightStyle
 }
 
 // NewContentExtractor creates a new ContentExtractor instance
 func NewContentExtractor(filesystem fs.FS) *ContentExtractor {
-	return &ContentExtractor{fs: filesystem}
+	return NewContentExtractorWithOptions(filesystem, Options{})
+}
+
+// NewContentExtractorWithOptions creates a new ContentExtractor instance with custom options
+func NewContentExtractorWithOptions(filesystem fs.FS, opts Options) *ContentExtractor {
+	return &ContentExtractor{
+		fs:            filesystem,
+		maxExpansions: opts.maxExpansions(),
+		analyzers:     opts.analyzers(),
+		highlight:     opts.Highlight,
+	}
 }
 
 // ExtractRelevantContent extracts content relevant to the query from a file
@@ -24,33 +37,143 @@ func (ce *ContentExtractor) ExtractRelevantContent(filePath, query string, conte
 		return "", err
 	}
 
-	contentStr := string(content)
-	queryTerms := normalizeQuery(query)
+	return ce.extractFromContent(string(content), query, contextLines)
+}
 
-	if len(queryTerms) == 0 {
-		// If no specific terms, return a reasonable sample
-		return ce.getContentSample(contentStr, 1000), nil
+// ExtractContentMatches returns the parts of a file relevant to the query, best first
+func (ce *ContentExtractor) ExtractContentMatches(filePath, query string, contextLines int) ([]ContentMatch, error) {
+	content, err := fs.ReadFile(ce.fs, filePath)
+	if err != nil {
+		return nil, err
 	}
 
-	// Find relevant sections
-	relevantSections := ce.findRelevantSections(contentStr, queryTerms, contextLines)
+	return ce.matchesInContent(string(content), query, contextLines)
+}
 
-	if len(relevantSections) == 0 {
+// extractFromContent extracts content relevant to the query from already loaded
+// file content, as text
+func (ce *ContentExtractor) extractFromContent(contentStr, query string, contextLines int) (string, error) {
+	matches, err := ce.matchesInContent(contentStr, query, contextLines)
+	if err != nil {
+		return "", err
+	}
+
+	if len(matches) == 0 {
 		// No specific matches, return beginning of file
 		return ce.getContentSample(contentStr, 1000), nil
 	}
 
 	// Combine and format the relevant sections
-	return ce.formatRelevantSections(contentStr, relevantSections), nil
+	return ce.formatContentMatches(matches), nil
+}
+
+// matchesInContent returns the parts of already loaded file content relevant to
+// the query, best first
+func (ce *ContentExtractor) matchesInContent(contentStr, query string, contextLines int) ([]ContentMatch, error) {
+	// The lines of the file are analyzed the way the file itself is
+	ce = ce.withDocumentAnalyzer(contentStr)
+
+	q, err := parseQuery(query, ce.analyzers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Regular expressions select exact lines, numbered like grep does
+	if regexes := regexNodes(q); len(regexes) > 0 {
+		if lines := ce.regexLines(contentStr, regexes); len(lines) > 0 {
+			return lines, nil
+		}
+	}
+
+	if len(q.Terms()) == 0 {
+		return nil, nil
+	}
+
+	// Fuzzy and wildcard terms match the words of this file, and when nothing
+	// matches every term is given the chance to be a typo
+	words := wordDictionaryOf(ce.analyzers.document, contentStr)
+	expandQuery(q, words, ce.maxExpansions)
+
+	// Find relevant sections
+	relevantSections := ce.findRelevantSections(contentStr, q, contextLines)
+	if len(relevantSections) == 0 {
+		if fuzzy := fuzzyQuery(q); fuzzy != nil {
+			expandQuery(fuzzy, words, ce.maxExpansions)
+			if sections := ce.findRelevantSections(contentStr, fuzzy, contextLines); len(sections) > 0 {
+				relevantSections = sections
+			}
+		}
+	}
+
+	matches := make([]ContentMatch, len(relevantSections))
+	for i, section := range relevantSections {
+		matches[i] = ContentMatch{
+			Content:    section.Content,
+			LineStart:  section.LineNumber + 1,
+			LineEnd:    section.EndLine + 1,
+			Context:    section.Breadcrumb,
+			Confidence: section.Score / (1 + section.Score),
+			Terms:      section.Terms,
+			Highlights: section.Highlights,
+			codeLines:  section.CodeLines,
+		}
+	}
+	return matches, nil
+}
+
+// withDocumentAnalyzer returns a copy of the extractor that analyzes text with
+// the analyzer of a document, and queries too short to be detected in its language
+func (ce *ContentExtractor) withDocumentAnalyzer(content string) *ContentExtractor {
+	copied := *ce
+	var lang Language
+	copied.analyzers.document, lang = ce.analyzers.forDocument(content)
+	copied.analyzers.fallback = lang
+	return &copied
+}
+
+// regexLines returns a match for every line matched by any of the regular
+// expressions, in order
+func (ce *ContentExtractor) regexLines(content string, regexes []*RegexNode) []ContentMatch {
+	matched := make(map[int][]string)
+	for _, re := range regexes {
+		for _, line := range re.matchingLines(content) {
+			matched[line] = append(matched[line], re.String())
+		}
+	}
+
+	lines := strings.Split(content, "\n")
+	code := codeLines(parseMarkdownLines(lines), len(lines))
+	var result []ContentMatch
+	for i, line := range lines {
+		if matched[i] != nil {
+			result = append(result, ContentMatch{
+				Content:    line,
+				LineStart:  i + 1,
+				LineEnd:    i + 1,
+				Confidence: 1,
+				Terms:      matched[i],
+				Highlights: highlightRegexes(line, regexes),
+				numbered:   true,
+				codeLines:  linesInCode(code, i, i),
+			})
+		}
+	}
+	return result
 }
 
 // findRelevantSections finds sections of the content that are relevant to the query
-func (ce *ContentExtractor) findRelevantSections(content string, queryTerms []string, contextLines int) []ContentSection {
+func (ce *ContentExtractor) findRelevantSections(content string, q *Query, contextLines int) []ContentSection {
 	lines := strings.Split(content, "\n")
 	var sections []ContentSection
+	queryTerms := q.Terms()
+	excludedTerms := q.ExcludedTerms()
 
 	// Score each line based on relevance
 	for i, line := range lines {
+		if ce.containsAnyWord(line, excludedTerms) {
+			continue // Lines about excluded terms are never relevant
+		}
+
 		score := ce.scoreLineRelevance(line, queryTerms)
 		if score > 0 {
 			sections = append(sections, ContentSection{
@@ -66,8 +189,19 @@ func (ce *ContentExtractor) findRelevantSections(content string, queryTerms []st
 		return sections[i].Score > sections[j].Score
 	})
 
-	// Expand highly relevant sections with context
-	expandedSections := ce.expandSectionsWithContext(lines, sections, contextLines)
+	// Expand highly relevant sections with context, labeled with the headings
+	// of their best line
+	outline := parseMarkdownLines(lines)
+	expandedSections := ce.expandSectionsWithContext(lines, outline, sections, contextLines)
+	code := codeLines(outline, len(lines))
+	for i, section := range expandedSections {
+		if s := outline.SectionAt(section.HitLine); s != nil {
+			expandedSections[i].Breadcrumb = sectionBreadcrumb(s)
+		}
+		expandedSections[i].Terms = ce.sectionTerms(lines[section.LineNumber:section.EndLine+1], queryTerms)
+		expandedSections[i].Highlights = highlightTerms(ce.analyzers.document, section.Content, queryTerms)
+		expandedSections[i].CodeLines = linesInCode(code, section.LineNumber, section.EndLine)
+	}
 
 	return expandedSections
 }
@@ -78,27 +212,28 @@ func (ce *ContentExtractor) scoreLineRelevance(line string, queryTerms []string)
 		return 0
 	}
 
-	lineLower := strings.ToLower(line)
 	score := 0.0
 	matchedTerms := 0
 
 	for _, term := range queryTerms {
 		termLower := strings.ToLower(term)
 
-		if strings.Contains(lineLower, termLower) {
-			matchedTerms++
+		if !ce.matchesTerm(line, termLower) {
+			continue
+		}
+		matchedTerms++
 
-			// Higher score for different types of matches
-			if ce.isExactWordMatch(lineLower, termLower) {
-				score += 1.0 // Exact word match
-			} else {
-				score += 0.5 // Partial match
-			}
+		if strings.Contains(termLower, " ") {
+			// A phrase is worth as much as all of its words matching exactly
+			score += float64(len(strings.Fields(termLower)))
+			continue
+		}
 
-			// Bonus for lines that look like important content
-			if ce.isImportantLine(line) {
-				score += 0.3
-			}
+		score += 1.0
+
+		// Bonus for lines that look like important content
+		if ce.isImportantLine(line) {
+			score += 0.3
 		}
 	}
 
@@ -110,11 +245,48 @@ func (ce *ContentExtractor) scoreLineRelevance(line string, queryTerms []string)
 	return score
 }
 
-// isExactWordMatch checks if a term appears as a complete word
-func (ce *ContentExtractor) isExactWordMatch(text, term string) bool {
-	pattern := `\b` + regexp.QuoteMeta(term) + `\b`
-	matched, _ := regexp.MatchString(pattern, text)
-	return matched
+// matchesTerm checks if a line contains a lowercased query term as a whole
+// analyzed term, and a phrase as consecutive ones
+func (ce *ContentExtractor) matchesTerm(line, term string) bool {
+	return ce.containsPhrase(line, term)
+}
+
+// sectionTerms returns the query terms matched by any of the lines, in query order
+func (ce *ContentExtractor) sectionTerms(lines []string, queryTerms []string) []string {
+	var terms []string
+	for _, term := range queryTerms {
+		termLower := strings.ToLower(term)
+		for _, line := range lines {
+			if ce.matchesTerm(line, termLower) {
+				terms = append(terms, term)
+				break
+			}
+		}
+	}
+	return terms
+}
+
+// containsAnyWord checks if any of the terms appears in the line as a complete word
+func (ce *ContentExtractor) containsAnyWord(line string, terms []string) bool {
+	if len(terms) == 0 {
+		return false
+	}
+
+	// Phrases and words are looked for among the words of the line
+	positions := positionsOf(ce.analyzers.document.Analyze(line))
+	for _, term := range terms {
+		if len(positions.phraseStarts(strings.Fields(term))) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// containsPhrase checks if the space separated words of a phrase appear one
+// after the other in a line
+func (ce *ContentExtractor) containsPhrase(line, phrase string) bool {
+	positions := positionsOf(ce.analyzers.document.Analyze(line))
+	return len(positions.phraseStarts(strings.Fields(phrase))) > 0
 }
 
 // isImportantLine identifies lines that are likely to contain important information
@@ -161,14 +333,17 @@ func (ce *ContentExtractor) isImportantLine(line string) bool {
 	return false
 }
 
-// expandSectionsWithContext adds context lines around relevant sections
-func (ce *ContentExtractor) expandSectionsWithContext(lines []string, sections []ContentSection, contextLines int) []ContentSection {
+// expandSectionsWithContext adds context lines around relevant sections. The
+// number of context lines is a target: the markdown blocks of the outline are
+// kept whole, see snippetWindow.
+func (ce *ContentExtractor) expandSectionsWithContext(lines []string, outline *Section, sections []ContentSection, contextLines int) []ContentSection {
 	if len(sections) == 0 {
 		return sections
 	}
 
 	var expandedSections []ContentSection
 	usedLines := make(map[int]bool)
+	blocks := structuralBlocks(outline, len(lines))
 
 	// Process sections by score (highest first)
 	for _, section := range sections {
@@ -176,8 +351,8 @@ func (ce *ContentExtractor) expandSectionsWithContext(lines []string, sections [
 			break
 		}
 
-		start := maxInt(0, section.LineNumber-contextLines)
-		end := minInt(len(lines), section.LineNumber+contextLines+1)
+		start, last := snippetWindow(blocks, section.LineNumber, contextLines)
+		end := last + 1
 
 		// Check if this section overlaps with already used lines
 		hasOverlap := false
@@ -205,6 +380,7 @@ func (ce *ContentExtractor) expandSectionsWithContext(lines []string, sections [
 				Score:      section.Score,
 				Content:    strings.Join(contextContent, "\n"),
 				EndLine:    end - 1,
+				HitLine:    section.LineNumber,
 			})
 		}
 	}
@@ -212,27 +388,103 @@ func (ce *ContentExtractor) expandSectionsWithContext(lines []string, sections [
 	return expandedSections
 }
 
-// formatRelevantSections formats the relevant sections into readable text
-func (ce *ContentExtractor) formatRelevantSections(originalContent string, sections []ContentSection) string {
-	if len(sections) == 0 {
-		return ce.getContentSample(originalContent, 1000)
+// structuralBlocks returns, for every line, the code block, table or list item
+// of the outline it is part of, or nil. Paragraphs can be cut anywhere.
+func structuralBlocks(outline *Section, lineCount int) []*Block {
+	blocks := make([]*Block, lineCount)
+	for _, s := range outline.All() {
+		for i := range s.Blocks {
+			b := &s.Blocks[i]
+			if b.Kind == BlockParagraph {
+				continue
+			}
+			for line := b.StartLine; line <= b.EndLine && line < lineCount; line++ {
+				blocks[line] = b
+			}
+		}
+	}
+	return blocks
+}
+
+// codeLines returns, for every line, whether it is part of a code block of
+// the outline
+func codeLines(outline *Section, lineCount int) []bool {
+	code := make([]bool, lineCount)
+	for line, b := range structuralBlocks(outline, lineCount) {
+		code[line] = b != nil && b.Kind == BlockCode
+	}
+	return code
+}
+
+// linesInCode returns whether each line from first to last is in a code
+// block, or nil when none is
+func linesInCode(code []bool, first, last int) []bool {
+	for _, inCode := range code[first : last+1] {
+		if inCode {
+			return code[first : last+1]
+		}
 	}
+	return nil
+}
+
+// snippetWindow returns the first and last lines of the snippet around a hit,
+// about contextLines on each side. The whole block of the hit is always in the
+// snippet, and an edge that would cut another block in half moves to include
+// or leave out that whole block, whichever moves it less, so that code fences
+// and tables aren't broken.
+func snippetWindow(blocks []*Block, hit, contextLines int) (int, int) {
+	start := maxInt(0, hit-contextLines)
+	end := minInt(len(blocks)-1, hit+contextLines)
+
+	if b := blocks[hit]; b != nil {
+		start = minInt(start, b.StartLine)
+		end = maxInt(end, b.EndLine)
+	}
+	if b := blocks[start]; b != nil && b.StartLine < start {
+		if grow, shrink := start-b.StartLine, b.EndLine+1-start; grow <= shrink {
+			start = b.StartLine
+		} else {
+			start = b.EndLine + 1
+		}
+	}
+	if b := blocks[end]; b != nil && b.EndLine > end {
+		if grow, shrink := b.EndLine-end, end+1-b.StartLine; grow <= shrink {
+			end = b.EndLine
+		} else {
+			end = b.StartLine - 1
+		}
+	}
+	return start, end
+}
 
+// formatContentMatches formats the relevant content into readable text, with
+// the matching words marked in the highlight style. Lines selected by regular
+// expressions are numbered like grep does.
+func (ce *ContentExtractor) formatContentMatches(matches []ContentMatch) string {
 	var result []string
 
-	for i, section := range sections {
+	for i, match := range matches {
+		if match.numbered {
+			result = append(result, fmt.Sprintf("%d: %s", match.LineStart, match.Highlighted(ce.highlight)))
+			continue
+		}
+
 		if i >= 10 { // Show up to 10 relevant sections
 			break
 		}
 
-		// Add section header
-		if len(sections) > 1 {
-			result = append(result, "--- Relevant Section ---")
+		// Add section header, named after the headings the section is under
+		if len(matches) > 1 {
+			if match.Context != "" {
+				result = append(result, "--- "+match.Context+" ---")
+			} else {
+				result = append(result, "--- Relevant Section ---")
+			}
 		}
 
-		result = append(result, section.Content)
+		result = append(result, match.Highlighted(ce.highlight))
 
-		if i < len(sections)-1 && len(sections) > 1 {
+		if i < len(matches)-1 && len(matches) > 1 {
 			result = append(result, "") // Empty line between sections
 		}
 	}
@@ -264,6 +516,11 @@ type ContentSection struct {
 	EndLine    int
 	Score      float64
 	Content    string
+	HitLine    int         // Best matching line
+	Breadcrumb string      // Headings the best matching line is under, such as "Transaction › Endpoints"
+	Terms      []string    // Query terms found in the section
+	Highlights []Highlight // Spans of the content matching the query
+	CodeLines  []bool      // Whether each line of the content is in a code block
 }
 
 // Helper functions
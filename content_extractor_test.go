@@ -0,0 +1,121 @@
+package search_engine
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestExtractContentMatches(t *testing.T) {
+	testFS := fstest.MapFS{
+		"vouchers.md": &fstest.MapFile{Data: []byte("# Vouchers\n" + // 1
+			"Intro\n" + // 2
+			"## Transaction\n" + // 3
+			"A transaction moves a voucher.\n" + // 4
+			"## Price\n" + // 5
+			"Filler\n" + // 6
+			"GET /api/voucherPrice\n")}, // 7
+	}
+
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngine(testFS), "index": indexed} {
+		matches, err := engine.ExtractContentMatches("vouchers.md", "transaction", 0)
+		if err != nil {
+			t.Fatalf("ExtractContentMatches() error = %v", err)
+		}
+		if len(matches) != 2 {
+			t.Fatalf("%s: ExtractContentMatches() = %+v, expected 2 matches", name, matches)
+		}
+
+		// The heading line is the best match, the sentence under it comes next
+		expected := []ContentMatch{
+			{Content: "## Transaction", LineStart: 3, LineEnd: 3, Context: "Transaction", Terms: []string{"transaction", "transact"},
+				Highlights: []Highlight{{Start: 3, End: 14, Term: "transaction"}}},
+			{Content: "A transaction moves a voucher.", LineStart: 4, LineEnd: 4, Context: "Transaction", Terms: []string{"transaction", "transact"},
+				Highlights: []Highlight{{Start: 2, End: 13, Term: "transaction"}}},
+		}
+		for i := range matches {
+			if matches[i].Confidence <= 0 || matches[i].Confidence >= 1 {
+				t.Errorf("%s: Confidence = %v, expected between 0 and 1", name, matches[i].Confidence)
+			}
+			matches[i].Confidence = 0
+		}
+		if !reflect.DeepEqual(matches, expected) {
+			t.Errorf("%s: ExtractContentMatches() = %+v, expected %+v", name, matches, expected)
+		}
+
+		content, err := engine.ExtractRelevantContent("vouchers.md", "transaction", 0)
+		if err != nil {
+			t.Fatalf("ExtractRelevantContent() error = %v", err)
+		}
+		if expected := "--- Transaction ---\n## Transaction\n\n--- Transaction ---\nA transaction moves a voucher."; content != expected {
+			t.Errorf("%s: ExtractRelevantContent() = %q, expected %q", name, content, expected)
+		}
+
+		matches, err = engine.ExtractContentMatches("vouchers.md", "/^GET /", 0)
+		if err != nil {
+			t.Fatalf("ExtractContentMatches() error = %v", err)
+		}
+		if len(matches) != 1 || matches[0].LineStart != 7 || matches[0].Content != "GET /api/voucherPrice" {
+			t.Errorf("%s: ExtractContentMatches(regex) = %+v, expected line 7", name, matches)
+		}
+
+		if matches, _ := engine.ExtractContentMatches("vouchers.md", "webhook", 2); len(matches) != 0 {
+			t.Errorf("%s: ExtractContentMatches(webhook) = %+v, expected none", name, matches)
+		}
+	}
+}
+
+func TestExtractContentMatches_BlockBoundaries(t *testing.T) {
+	testFS := fstest.MapFS{
+		"api.md": &fstest.MapFile{Data: []byte("# API\n" + // 1
+			"Intro text.\n" + // 2
+			"```\n" + // 3
+			"GET /vouchers\n" + // 4
+			"POST /vouchers\n" + // 5
+			"```\n" + // 6
+			"The endpoint returns a list.\n" + // 7
+			"\n" + // 8
+			"| Field | Type |\n" + // 9
+			"|-------|------|\n" + // 10
+			"| id | int |\n" + // 11
+			"| name | string |\n" + // 12
+			"| code | string |\n" + // 13
+			"\n" + // 14
+			"- First item\n" + // 15
+			"  continues here\n" + // 16
+			"- Second item mentions refunds\n" + // 17
+			"- Third item")}, // 18
+	}
+	extractor := NewContentExtractor(testFS)
+
+	tests := []struct {
+		name         string
+		query        string
+		contextLines int
+		lineStart    int
+		lineEnd      int
+	}{
+		// Lines 5-9 would cut the fence, which is closer to whole, and the
+		// table, which is closer to left out
+		{"grow into a fence, shrink before a table", "returns", 2, 3, 8},
+		{"whole block of the hit", "name", 0, 9, 13},
+		{"whole list items", "refunds", 1, 15, 18},
+		{"paragraphs are cut", "intro", 0, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := extractor.ExtractContentMatches("api.md", tt.query, tt.contextLines)
+			if err != nil {
+				t.Fatalf("ExtractContentMatches() error = %v", err)
+			}
+			if len(matches) != 1 || matches[0].LineStart != tt.lineStart || matches[0].LineEnd != tt.lineEnd {
+				t.Errorf("ExtractContentMatches(%q) = %+v, expected lines %d-%d", tt.query, matches, tt.lineStart, tt.lineEnd)
+			}
+		})
+	}
+}
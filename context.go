@@ -0,0 +1,223 @@
+package search_engine
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenCounter counts the tokens a text takes in the context window of a
+// language model
+type TokenCounter interface {
+	CountTokens(text string) int
+}
+
+// TokenCounterFunc adapts a function, such as the tokenizer of a model, to a TokenCounter
+type TokenCounterFunc func(text string) int
+
+// CountTokens implements TokenCounter
+func (f TokenCounterFunc) CountTokens(text string) int { return f(text) }
+
+// HeuristicTokenCounter estimates tokens without a tokenizer: about four
+// characters per token, and at least one token per word
+type HeuristicTokenCounter struct{}
+
+// CountTokens implements TokenCounter
+func (HeuristicTokenCounter) CountTokens(text string) int {
+	return max((utf8.RuneCountInString(text)+3)/4, len(strings.Fields(text)))
+}
+
+// maxContextSections limits the sections considered for a context
+const maxContextSections = 200
+
+// PackedContext is the content of the sections most relevant to a query,
+// packed into a token budget for a language model
+type PackedContext struct {
+	Query     string           `json:"query"`
+	Sections  []ContextSection `json:"sections"`   // Sections in order of relevance
+	Tokens    int              `json:"tokens"`     // Tokens of the sections with their headers
+	MaxTokens int              `json:"max_tokens"` // Token budget
+	Omitted   int              `json:"omitted"`    // Relevant sections left out for lack of budget
+}
+
+// ContextSection is a section of a file in a packed context
+type ContextSection struct {
+	Path       string   `json:"path"`       // Relative path to the file
+	Breadcrumb []string `json:"breadcrumb"` // Headings leading to the section, outermost first
+	LineStart  int      `json:"line_start"` // First line of the content, 1-based
+	LineEnd    int      `json:"line_end"`   // Last line of the content, 1-based
+	Score      float64  `json:"score"`      // Relevance score of the section
+	Content    string   `json:"content"`    // Text of the section
+	Tokens     int      `json:"tokens"`     // Tokens of the content with its header
+	Truncated  bool     `json:"truncated"`  // Whether the section was cut at a block or sentence boundary
+}
+
+// header returns the line introducing the section in a packed context
+func (s ContextSection) header() string {
+	location := strings.Join(append([]string{s.Path}, s.Breadcrumb...), breadcrumbSeparator)
+	return fmt.Sprintf("--- %s (lines %d-%d) ---", location, s.LineStart, s.LineEnd)
+}
+
+// text returns the section as it is written in a packed context
+func (s ContextSection) text() string {
+	return s.header() + "\n" + s.Content + "\n"
+}
+
+// String returns the sections, each under a header with its location, ready to
+// be given to a language model
+func (c *PackedContext) String() string {
+	texts := make([]string, len(c.Sections))
+	for i, s := range c.Sections {
+		texts[i] = s.text()
+	}
+	return strings.Join(texts, "\n")
+}
+
+// buildContext fills a token budget with the sections of all files most
+// relevant to the query, best first. Sections that don't fit whole are cut
+// after their last block that fits, or their last sentence that fits in a
+// paragraph or list item, and dropped when nothing of them fits. Sections
+// repeating the text of a section already packed are left out.
+func buildContext(engine SearchEngine, query string, maxTokens int, counter TokenCounter) (*PackedContext, error) {
+	matches, err := engine.SearchSections(query, maxContextSections)
+	if err != nil {
+		return nil, err
+	}
+
+	packed := &PackedContext{Query: query, MaxTokens: maxTokens}
+	outlines := make(map[string]*Section)
+	contents := make(map[string]string)
+	seen := make(map[string]bool)
+
+	for _, match := range matches {
+		content, ok := contents[match.Path]
+		if !ok {
+			content, err = engine.GetFileContent(match.Path)
+			if err != nil {
+				continue
+			}
+			contents[match.Path] = content
+			outlines[match.Path] = ParseMarkdown(content)
+		}
+
+		match = trimBlankLines(content, match)
+		if s := matchedSection(outlines[match.Path], match); s != nil && match.LineEnd-1 <= s.headingEnd {
+			continue // Nothing but the heading
+		}
+
+		key := strings.Join(strings.Fields(foldCase(sectionText(content, match))), " ")
+		if seen[key] {
+			continue // Duplicate text
+		}
+		seen[key] = true
+
+		section, fits := packSection(content, outlines[match.Path], match, maxTokens-packed.Tokens, counter)
+		if !fits {
+			packed.Omitted++
+			continue
+		}
+		packed.Sections = append(packed.Sections, section)
+		packed.Tokens += section.Tokens
+	}
+	return packed, nil
+}
+
+// sectionText returns the lines of the content a section match covers
+func sectionText(content string, match SectionMatch) string {
+	lines := strings.Split(content, "\n")
+	if match.LineStart < 1 || match.LineEnd > len(lines) || match.LineStart > match.LineEnd {
+		return ""
+	}
+	return strings.Join(lines[match.LineStart-1:match.LineEnd], "\n")
+}
+
+// trimBlankLines moves the end of a section match before its trailing blank lines
+func trimBlankLines(content string, match SectionMatch) SectionMatch {
+	lines := strings.Split(content, "\n")
+	for match.LineEnd > match.LineStart && match.LineEnd <= len(lines) && strings.TrimSpace(lines[match.LineEnd-1]) == "" {
+		match.LineEnd--
+	}
+	return match
+}
+
+// packSection returns as much of a section as fits in the budget, and whether
+// anything beyond its heading fits
+func packSection(content string, outline *Section, match SectionMatch, budget int, counter TokenCounter) (ContextSection, bool) {
+	section := ContextSection{
+		Path:       match.Path,
+		Breadcrumb: match.Breadcrumb,
+		LineStart:  match.LineStart,
+		LineEnd:    match.LineEnd,
+		Score:      match.Score,
+		Content:    sectionText(content, match),
+	}
+	if section.Tokens = counter.CountTokens(section.text()); section.Tokens <= budget {
+		return section, true
+	}
+
+	// Keep the heading and the blocks that fit whole, then the sentences that
+	// fit of the next paragraph or list item
+	s := matchedSection(outline, match)
+	if s == nil || s.Level == 0 {
+		return section, false
+	}
+	start := s.Start
+
+	cut := func(end, endLine int) ContextSection {
+		partial := section
+		partial.Content = content[start:end]
+		partial.LineEnd = endLine + 1
+		partial.Truncated = true
+		partial.Tokens = counter.CountTokens(partial.text())
+		return partial
+	}
+
+	var best ContextSection
+	found := false
+	for _, b := range s.Blocks {
+		if b.StartLine < s.StartLine || b.EndLine+1 > match.LineEnd {
+			break
+		}
+		if whole := cut(b.End, b.EndLine); whole.Tokens <= budget {
+			best, found = whole, true
+			continue
+		}
+		if b.Kind == BlockParagraph || b.Kind == BlockListItem {
+			for _, end := range sentenceEnds(content[b.Start:b.End]) {
+				partial := cut(b.Start+end, b.StartLine+strings.Count(content[b.Start:b.Start+end], "\n"))
+				if partial.Tokens > budget {
+					break
+				}
+				best, found = partial, true
+			}
+		}
+		break
+	}
+	return best, found
+}
+
+// matchedSection returns the section of the outline a match is about
+func matchedSection(outline *Section, match SectionMatch) *Section {
+	for _, s := range outline.All() {
+		if s.StartLine == match.LineStart-1 && slices.Equal(sectionHeadings(s), match.Breadcrumb) {
+			return s
+		}
+	}
+	return nil
+}
+
+// sentenceEnds returns the byte offsets right after every sentence of a text:
+// after a ., ! or ? followed by a space or the end of the text
+func sentenceEnds(text string) []int {
+	var ends []int
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '.', '!', '?':
+			if i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\n' || text[i+1] == '\t' {
+				ends = append(ends, i+1)
+			}
+		}
+	}
+	return ends
+}
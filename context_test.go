@@ -0,0 +1,134 @@
+package search_engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func contextTestFS() fstest.MapFS {
+	return fstest.MapFS{
+		"guide.md": &fstest.MapFile{Data: []byte("# Guide\n" + // 1
+			"Read this first.\n" + // 2
+			"## Webhooks\n" + // 3
+			"Webhooks post events to your server. Webhooks are signed. Failed webhooks are retried.\n" + // 4
+			"\n" + // 5
+			"```\n" + // 6
+			"POST /webhooks\n" + // 7
+			"```\n" + // 8
+			"## Install\n" + // 9
+			"Run the installer.")}, // 10
+		"copy.md": &fstest.MapFile{Data: []byte("# Copy\n## Webhooks\n" +
+			"Webhooks post events to your server.  Webhooks are signed. Failed webhooks are retried.\n\n" +
+			"```\nPOST /webhooks\n```")},
+		"faq.md": &fstest.MapFile{Data: []byte("# FAQ\n## Retries\nWebhooks are retried three times.")},
+	}
+}
+
+func TestBuildContext(t *testing.T) {
+	testFS := contextTestFS()
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+
+	var packed []*PackedContext
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngine(testFS), "index": indexed} {
+		ctx, err := engine.BuildContext("webhooks", 1000)
+		if err != nil {
+			t.Fatalf("BuildContext() error = %v", err)
+		}
+		if len(ctx.Sections) != 2 {
+			t.Fatalf("%s: BuildContext() = %+v, expected 2 sections", name, ctx.Sections)
+		}
+
+		best := ctx.Sections[0]
+		if !reflect.DeepEqual(best.Breadcrumb, []string{"Webhooks"}) || best.LineStart < 2 || best.Truncated {
+			t.Errorf("%s: BuildContext()[0] = %+v, expected the whole Webhooks section", name, best)
+		}
+		if !strings.HasSuffix(best.Content, "POST /webhooks\n```") {
+			t.Errorf("%s: BuildContext()[0].Content = %q, expected the code block", name, best.Content)
+		}
+		if ctx.Sections[1].Path != "faq.md" {
+			t.Errorf("%s: BuildContext()[1] = %+v, expected the FAQ after the duplicate is dropped", name, ctx.Sections[1])
+		}
+
+		total := 0
+		for _, s := range ctx.Sections {
+			total += s.Tokens
+		}
+		if ctx.Tokens != total || ctx.Tokens > ctx.MaxTokens {
+			t.Errorf("%s: BuildContext() used %d tokens, sections have %d of %d", name, ctx.Tokens, total, ctx.MaxTokens)
+		}
+		if !strings.HasPrefix(ctx.String(), "--- "+best.Path+" › Webhooks (lines ") {
+			t.Errorf("%s: String() = %q", name, ctx.String())
+		}
+		packed = append(packed, ctx)
+	}
+	if !reflect.DeepEqual(packed[0], packed[1]) {
+		t.Errorf("engines disagree: %+v and %+v", packed[0], packed[1])
+	}
+}
+
+func TestBuildContext_Truncation(t *testing.T) {
+	// One token per word makes the cuts easy to predict
+	words := TokenCounterFunc(func(text string) int { return len(strings.Fields(text)) })
+	testFS := fstest.MapFS{"guide.md": contextTestFS()["guide.md"]}
+	engine := NewSearchEngineWithOptions(testFS, Options{TokenCounter: words})
+
+	tests := []struct {
+		name      string
+		maxTokens int
+		content   string
+		truncated bool
+	}{
+		{"whole section", 100, "## Webhooks\nWebhooks post events to your server. Webhooks are signed. Failed webhooks are retried.\n\n```\nPOST /webhooks\n```", false},
+		{"whole paragraph", 24, "## Webhooks\nWebhooks post events to your server. Webhooks are signed. Failed webhooks are retried.", true},
+		{"sentences", 20, "## Webhooks\nWebhooks post events to your server. Webhooks are signed.", true},
+		{"first sentence", 17, "## Webhooks\nWebhooks post events to your server.", true},
+		{"nothing fits", 10, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, err := engine.BuildContext("webhooks", tt.maxTokens)
+			if err != nil {
+				t.Fatalf("BuildContext() error = %v", err)
+			}
+			if tt.content == "" {
+				if len(ctx.Sections) != 0 || ctx.Omitted != 1 {
+					t.Errorf("BuildContext() = %+v, expected the section to be omitted", ctx)
+				}
+				return
+			}
+			if len(ctx.Sections) != 1 {
+				t.Fatalf("BuildContext() = %+v, expected 1 section", ctx.Sections)
+			}
+			s := ctx.Sections[0]
+			if s.Content != tt.content || s.Truncated != tt.truncated {
+				t.Errorf("BuildContext() = %q (truncated %v), expected %q (truncated %v)", s.Content, s.Truncated, tt.content, tt.truncated)
+			}
+			if s.Tokens > tt.maxTokens || s.Tokens != words(s.text()) {
+				t.Errorf("BuildContext() counted %d tokens for a budget of %d", s.Tokens, tt.maxTokens)
+			}
+		})
+	}
+}
+
+func TestHeuristicTokenCounter(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{"", 0},
+		{"abcd", 1},
+		{"abcdefgh", 2},
+		{"a b c d e", 5},
+		{"código", 2},
+	}
+	for _, tt := range tests {
+		if got := (HeuristicTokenCounter{}).CountTokens(tt.text); got != tt.expected {
+			t.Errorf("CountTokens(%q) = %d, expected %d", tt.text, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package search_engine
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field identifies a part of a document that is scored separately
+type Field int
+
+const (
+	FieldPath     Field = iota // Directory components of the path
+	FieldFileName              // File name without extension
+	FieldTitle                 // First H1 of the document, or its first heading when it has no H1
+	FieldHeading               // Other heading lines
+	FieldBody                  // Paragraphs, lists and everything else
+	FieldCode                  // Fenced code blocks and inline HTML code
+	FieldTable                 // Markdown and HTML tables
+
+	fieldCount int = iota
+)
+
+// fieldNames are the names used for fields in reasons and on the command line
+var fieldNames = [fieldCount]string{"path", "filename", "title", "headings", "body", "code", "table"}
+
+func (f Field) String() string {
+	if f < 0 || int(f) >= fieldCount {
+		return "unknown"
+	}
+	return fieldNames[f]
+}
+
+// ParseField returns the field with the given name
+func ParseField(name string) (Field, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for f, fieldName := range fieldNames {
+		if name == fieldName {
+			return Field(f), nil
+		}
+	}
+	if name == "heading" {
+		return FieldHeading, nil
+	}
+	return 0, fmt.Errorf("unknown field %q", name)
+}
+
+// contentFields are the fields a line of content can belong to
+var contentFields = []Field{FieldTitle, FieldHeading, FieldBody, FieldCode, FieldTable}
+
+// FieldBoosts maps fields to the weight of a match in them
+type FieldBoosts map[Field]float64
+
+// DefaultFieldBoosts returns the default field weights: headings count more than
+// body text, and code and tables less
+func DefaultFieldBoosts() FieldBoosts {
+	return FieldBoosts{
+		FieldPath:     2.0,
+		FieldFileName: 3.0,
+		FieldTitle:    3.0,
+		FieldHeading:  2.0,
+		FieldBody:     1.0,
+		FieldCode:     0.5,
+		FieldTable:    0.8,
+	}
+}
+
+// ParseFieldBoosts parses a comma separated list of field=weight pairs such as
+// "heading=3,code=0.2" and applies them on top of the defaults
+func ParseFieldBoosts(spec string) (FieldBoosts, error) {
+	boosts := DefaultFieldBoosts()
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid field boost %q, expected field=weight", pair)
+		}
+
+		field, err := ParseField(name)
+		if err != nil {
+			return nil, err
+		}
+
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight for field %s: %v", field, err)
+		}
+		boosts[field] = weight
+	}
+	return boosts, nil
+}
+
+// Document is a file analyzed for searching
+type Document struct {
+	Path    string    // Relative path to the file
+	Content string    // Original file content
+	Size    int64     // File size when it was read
+	ModTime time.Time // File modification time when it was read
+	// Language is the language the document declares or is detected to be
+	// written in, "" when it can't be told
+	Language Language
+	lower    string // Lowercased content used for scoring
+	fields   [fieldCount]fieldTerms
+	// outline is the section tree of the content
+	outline *Section
+	// lineFields holds the field of each line of the content
+	lineFields []Field
+	// fieldText holds the lowercased directory, the lowercased file name without
+	// its extension and the lowercased lines of each content field, joined by newlines
+	fieldText [fieldCount]string
+	// positions holds the token positions of every content term
+	positions termPositions
+	// tokenLines holds the line of every content token
+	tokenLines []int
+	// words holds the terms found in the text, rather than only derived from it as stems
+	words map[string]bool
+}
+
+// LineField returns the field a zero-based line of the content belongs to
+func (d *Document) LineField(line int) Field {
+	if line < 0 || line >= len(d.lineFields) {
+		return FieldBody
+	}
+	return d.lineFields[line]
+}
+
+// Outline returns the tree of the sections of the content
+func (d *Document) Outline() *Section {
+	return d.outline
+}
+
+// fieldTerms holds the term frequencies of a single document field
+type fieldTerms struct {
+	freq   map[string]int
+	length int // Number of tokens in the field
+}
+
+// walkDocumentationFiles calls fn, in walk order, for every documentation file
+func walkDocumentationFiles(filesystem fs.FS, fn func(path string, info fs.FileInfo)) error {
+	return fs.WalkDir(filesystem, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip errors, don't fail entire search
+		}
+
+		if d.IsDir() || !isDocumentationFile(path) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed while walking
+		}
+
+		fn(path, info)
+		return nil
+	})
+}
+
+// readDocument reads a file into a new document. Unreadable files are still
+// kept so that they can be found by their name.
+func readDocument(filesystem fs.FS, path string, info fs.FileInfo, analysis analyzers) *Document {
+	content, _ := fs.ReadFile(filesystem, path)
+
+	doc := analysis.newDocument(path, string(content))
+	doc.Size = info.Size()
+	doc.ModTime = info.ModTime()
+	return doc
+}
+
+// newDocument creates a document for the given file content with the default analyzers
+func newDocument(path, content string) *Document {
+	return defaultAnalyzers.newDocument(path, content)
+}
+
+// analyzeDocument creates and analyzes a document for the given file content
+func analyzeDocument(path, content string, analyzer Analyzer) *Document {
+	doc := newDocumentText(path, content, analyzer)
+
+	lineStarts := []int{0}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	tokens := analyzer.Analyze(content)
+	lines := make([]int, len(tokens))
+	for i, tok := range tokens {
+		lines[i] = sort.SearchInts(lineStarts, tok.Start+1) - 1
+	}
+	doc.setContentTokens(tokens, lines)
+	return doc
+}
+
+// newDocumentText creates a document with its path and file name analyzed and
+// its content split into fields, without the terms of the content
+func newDocumentText(path, content string, analyzer Analyzer) *Document {
+	doc := &Document{
+		Path:    path,
+		Content: content,
+		lower:   normalizeText(analyzer, content),
+	}
+
+	fileName := filepath.Base(path)
+	dir, name := filepath.Dir(path), strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	doc.addFieldTerms(FieldPath, analyzer.Analyze(dir))
+	doc.addFieldTerms(FieldFileName, analyzer.Analyze(name))
+	doc.fieldText[FieldPath] = normalizeText(analyzer, dir)
+	doc.fieldText[FieldFileName] = normalizeText(analyzer, name)
+
+	lines := strings.Split(doc.lower, "\n")
+	doc.outline = ParseMarkdown(content)
+	doc.lineFields = doc.outline.lineFields(len(lines))
+
+	var fieldLines [fieldCount][]string
+	for i, line := range lines {
+		f := doc.lineFields[i]
+		fieldLines[f] = append(fieldLines[f], line)
+	}
+	for _, f := range contentFields {
+		doc.fieldText[f] = strings.Join(fieldLines[f], "\n")
+	}
+
+	return doc
+}
+
+// setContentTokens records the tokens of the content, ordered by position,
+// with the line of each
+func (d *Document) setContentTokens(tokens []Token, lines []int) {
+	d.positions = positionsOf(tokens)
+	if len(tokens) > 0 {
+		d.tokenLines = make([]int, tokens[len(tokens)-1].Position+1)
+	}
+	var fieldTokens [fieldCount][]Token
+	for i, tok := range tokens {
+		f := d.lineFields[lines[i]]
+		fieldTokens[f] = append(fieldTokens[f], tok)
+		d.tokenLines[tok.Position] = lines[i]
+	}
+	for _, f := range contentFields {
+		if len(fieldTokens[f]) > 0 {
+			d.addFieldTerms(f, fieldTokens[f])
+		}
+	}
+}
+
+// addFieldTerms counts tokens as part of a field. Alternatives at the same
+// position, such as stems, count once towards the length of the field.
+func (d *Document) addFieldTerms(field Field, tokens []Token) {
+	f := &d.fields[field]
+	if f.freq == nil {
+		f.freq = make(map[string]int)
+	}
+	if d.words == nil {
+		d.words = make(map[string]bool)
+	}
+	for i, tok := range tokens {
+		f.freq[tok.Term]++
+		if i == 0 || tok.Position != tokens[i-1].Position {
+			f.length++
+		}
+		if !tok.Derived {
+			d.words[tok.Term] = true
+		}
+	}
+}
+
+// scopedText returns the lowercased lines of the content fields in fields
+func (d *Document) scopedText(fields []Field) string {
+	var parts []string
+	for _, field := range contentFields {
+		for _, f := range fields {
+			if f == field && d.fieldText[field] != "" {
+				parts = append(parts, d.fieldText[field])
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// containsAnyTerm reports whether any of the lowercased terms occurs in any of
+// the fields, or in any field when fields is nil. Words match whole analyzed
+// terms, as they do when scoring; phrases match consecutive words.
+func (d *Document) containsAnyTerm(terms []string, fields []Field) bool {
+	for _, term := range terms {
+		for f := range d.fields {
+			if fields != nil && !slices.Contains(fields, Field(f)) {
+				continue
+			}
+			if d.TermFrequency(Field(f), term) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TermFrequency returns how many times a lowercased term occurs in a field.
+// A term made of several space separated words counts occurrences of that exact
+// phrase, attributed to the field of its first word.
+func (d *Document) TermFrequency(field Field, term string) int {
+	if !strings.Contains(term, " ") {
+		return d.fields[field].freq[term]
+	}
+
+	count := 0
+	for _, start := range d.positions.phraseStarts(strings.Fields(term)) {
+		if d.LineField(d.tokenLines[start]) == field {
+			count++
+		}
+	}
+	return count
+}
+
+// termPositions holds the token positions of every term of a text
+type termPositions map[string][]int
+
+// positionsOf returns the positions of the terms of analyzed tokens
+func positionsOf(tokens []Token) termPositions {
+	positions := make(termPositions)
+	for _, tok := range tokens {
+		positions[tok.Term] = append(positions[tok.Term], tok.Position)
+	}
+	return positions
+}
+
+// phraseStarts returns the positions where the words occur one right after the other
+func (p termPositions) phraseStarts(words []string) []int {
+	if len(words) == 0 {
+		return nil
+	}
+
+	var starts []int
+	for _, start := range p[words[0]] {
+		found := true
+		for i, word := range words[1:] {
+			if !containsInt(p[word], start+i+1) {
+				found = false
+				break
+			}
+		}
+		if found {
+			starts = append(starts, start)
+		}
+	}
+	return starts
+}
+
+// withinSlop reports whether all the words occur, in any order, in a window of
+// len(words)+slop consecutive positions
+func (p termPositions) withinSlop(words []string, slop int) bool {
+	if len(words) == 0 {
+		return false
+	}
+
+	// Merge the positions of every word, then slide a window over them looking
+	// for one that contains every word as many times as it is in the phrase
+	type hit struct{ pos, word int }
+	wordID := make(map[string]int)
+	var need []int
+	for _, word := range words {
+		if _, ok := wordID[word]; !ok {
+			wordID[word] = len(need)
+			need = append(need, 0)
+		}
+		need[wordID[word]]++
+	}
+
+	var hits []hit
+	for word, id := range wordID {
+		for _, pos := range p[word] {
+			hits = append(hits, hit{pos, id})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].pos < hits[j].pos })
+
+	have := make([]int, len(wordID))
+	missing := len(words)
+
+	left := 0
+	for _, h := range hits {
+		if have[h.word] < need[h.word] {
+			missing--
+		}
+		have[h.word]++
+
+		for missing == 0 {
+			if h.pos-hits[left].pos+1 <= len(words)+slop {
+				return true
+			}
+			first := hits[left]
+			have[first.word]--
+			if have[first.word] < need[first.word] {
+				missing++
+			}
+			left++
+		}
+	}
+	return false
+}
+
+func containsInt(sorted []int, value int) bool {
+	i := sort.SearchInts(sorted, value)
+	return i < len(sorted) && sorted[i] == value
+}
+
+// FieldLength returns the number of tokens in a field
+func (d *Document) FieldLength(field Field) int {
+	return d.fields[field].length
+}
+
+// classifyLines assigns a field to every line of a markdown or HTML document
+func classifyLines(lines []string) []Field {
+	return parseMarkdownLines(lines).lineFields(len(lines))
+}
+
+// headingLevel returns the level of a markdown ATX or HTML heading line, or 0
+func headingLevel(line string) int {
+	if strings.HasPrefix(line, "#") {
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		if level <= 6 && (len(line) == level || line[level] == ' ') {
+			return level
+		}
+		return 0
+	}
+
+	if len(line) > 3 && line[0] == '<' && (line[1] == 'h' || line[1] == 'H') &&
+		line[2] >= '1' && line[2] <= '6' && (line[3] == '>' || line[3] == ' ') {
+		return int(line[2] - '0')
+	}
+	return 0
+}
+
+// isSetextUnderline reports whether a line underlines the previous one as a heading
+func isSetextUnderline(line string) bool {
+	if len(line) < 2 {
+		return false
+	}
+	return strings.Trim(line, "=") == "" || strings.Trim(line, "-") == ""
+}
@@ -0,0 +1,61 @@
+package search_engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyLines(t *testing.T) {
+	lines := []string{
+		"# Vouchers",                 // 0 title
+		"Intro text",                 // 1
+		"## Authentication",          // 2
+		"```json",                    // 3
+		`{"token": "abc"}`,           // 4
+		"```",                        // 5
+		"| Name | Type |",            // 6
+		"|------|------|",            // 7
+		"Setext heading",             // 8
+		"--------------",             // 9
+		"<h3>Filtering</h3>",         // 10
+		`<code>curl -H "key"</code>`, // 11
+		"<table>",                    // 12
+		"<tr><td>Local</td></tr>",    // 13
+		"</table>",                   // 14
+		"#hashtag is not a heading",  // 15
+	}
+
+	expected := []Field{
+		FieldTitle, FieldBody, FieldHeading, FieldCode, FieldCode, FieldCode,
+		FieldTable, FieldTable, FieldHeading, FieldHeading, FieldHeading, FieldCode,
+		FieldTable, FieldTable, FieldTable, FieldBody,
+	}
+
+	if got := classifyLines(lines); !reflect.DeepEqual(got, expected) {
+		t.Errorf("classifyLines() = %v, expected %v", got, expected)
+	}
+}
+
+func TestClassifyLines_TitleWithoutH1(t *testing.T) {
+	lines := []string{"<apidoc />", "", "Dates", "-----", "## Formats"}
+	fields := classifyLines(lines)
+	if fields[2] != FieldTitle || fields[4] != FieldHeading {
+		t.Errorf("Expected the first heading to be the title, got %v", fields)
+	}
+}
+
+func TestParseFieldBoosts(t *testing.T) {
+	boosts, err := ParseFieldBoosts("heading=3, code=0.2")
+	if err != nil {
+		t.Fatalf("ParseFieldBoosts() error = %v", err)
+	}
+	if boosts[FieldHeading] != 3 || boosts[FieldCode] != 0.2 || boosts[FieldBody] != 1 {
+		t.Errorf("Unexpected boosts %v", boosts)
+	}
+
+	for _, spec := range []string{"heading", "footer=2", "code=high"} {
+		if _, err := ParseFieldBoosts(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
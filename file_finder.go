@@ -5,100 +5,144 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"unicode"
 )
 
 // FileFinder handles finding relevant files based on queries
 type FileFinder struct {
-	fs fs.FS
+	fs            fs.FS
+	scorer        Scorer
+	maxExpansions int
+	analyzers     analyzers
 }
 
 // NewFileFinder creates a new FileFinder instance
 func NewFileFinder(filesystem fs.FS) *FileFinder {
-	return &FileFinder{fs: filesystem}
+	return NewFileFinderWithOptions(filesystem, Options{})
+}
+
+// NewFileFinderWithOptions creates a new FileFinder instance with custom options
+func NewFileFinderWithOptions(filesystem fs.FS, opts Options) *FileFinder {
+	return &FileFinder{
+		fs:            filesystem,
+		scorer:        opts.scorer(),
+		maxExpansions: opts.maxExpansions(),
+		analyzers:     opts.analyzers(),
+	}
 }
 
 // FindRelevantFiles finds files most relevant to the query
 func (ff *FileFinder) FindRelevantFiles(query string, maxFiles int) ([]FileMatch, error) {
-	var allMatches []FileMatch
-	
-	// Normalize query for better matching
-	queryTerms := normalizeQuery(query)
-	
-	// Walk through all files in the filesystem
-	err := fs.WalkDir(ff.fs, ".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return nil // Skip errors, don't fail entire search
-		}
-		
-		if d.IsDir() {
-			return nil
-		}
-		
-		// Only search documentation files
-		if !isDocumentationFile(path) {
-			return nil
-		}
-		
-		// Calculate relevance score for this file
-		score, reason := ff.calculateFileScore(path, queryTerms)
-		if score > 0 {
-			allMatches = append(allMatches, FileMatch{
-				Path:     path,
-				Score:    score,
-				Reason:   reason,
-				FileName: filepath.Base(path),
-			})
-		}
-		
-		return nil
-	})
+	docs, err := ff.readDocuments()
+	if err != nil {
+		return nil, err
+	}
+	stats := newCorpusStats(docs)
 	
+	// Parse the query, its terms are normalized for better matching
+	q, err := parseQuery(query, ff.analyzers.withFallback(stats.language))
 	if err != nil {
 		return nil, err
 	}
 	
-	// Sort by score (highest first)
-	sort.Slice(allMatches, func(i, j int) bool {
-		return allMatches[i].Score > allMatches[j].Score
+	all := func(*Query) []*Document { return docs }
+	matches, _ := searchDocuments(q, all, ff.scorer, stats, ff.maxExpansions)
+	return rankFileMatches(matches, maxFiles), nil
+}
+
+// SearchSections finds the sections of all files most relevant to the query
+func (ff *FileFinder) SearchSections(query string, maxSections int) ([]SectionMatch, error) {
+	docs, err := ff.readDocuments()
+	if err != nil {
+		return nil, err
+	}
+	stats := newCorpusStats(docs)
+
+	q, err := parseQuery(query, ff.analyzers.withFallback(stats.language))
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the sections of the matching files are ranked
+	byPath := make(map[string]*Document, len(docs))
+	for _, doc := range docs {
+		byPath[doc.Path] = doc
+	}
+	all := func(*Query) []*Document { return docs }
+	matches, q := searchDocuments(q, all, ff.scorer, stats, ff.maxExpansions)
+	matched := make([]*Document, len(matches))
+	for i, m := range matches {
+		matched[i] = byPath[m.Path]
+	}
+	return rankSectionMatches(scoreSections(q, matched, ff.scorer, ff.analyzers), maxSections), nil
+}
+
+// readDocuments walks through all files in the filesystem. Every file is
+// loaded before scoring because some scorers need statistics of the whole
+// collection.
+func (ff *FileFinder) readDocuments() ([]*Document, error) {
+	var docs []*Document
+	err := walkDocumentationFiles(ff.fs, func(path string, info fs.FileInfo) {
+		docs = append(docs, readDocument(ff.fs, path, info, ff.analyzers))
 	})
-	
-	// Limit results
-	if maxFiles > 0 && len(allMatches) > maxFiles {
-		allMatches = allMatches[:maxFiles]
-	} else if maxFiles <= 0 {
+	return docs, err
+}
+
+// rankFileMatches sorts matches by score (highest first) and limits the results.
+// Ties keep their walk order so that every engine ranks them the same way.
+func rankFileMatches(matches []FileMatch, maxFiles int) []FileMatch {
+	if maxFiles <= 0 {
 		// Return empty results for zero or negative maxFiles
-		allMatches = []FileMatch{}
+		return []FileMatch{}
 	}
-	
-	return allMatches, nil
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	if len(matches) > maxFiles {
+		matches = matches[:maxFiles]
+	}
+
+	return matches
 }
 
 // calculateFileScore calculates how relevant a file is to the query
 func (ff *FileFinder) calculateFileScore(filePath string, queryTerms []string) (float64, string) {
-	if len(queryTerms) == 0 {
-		return 0, ""
-	}
-	
+	// Unreadable files are still scored by their name
+	content, _ := fs.ReadFile(ff.fs, filePath)
+	doc := ff.analyzers.newDocument(filePath, string(content))
+	return ff.scorer.Score(doc, plainQueryTerms(queryTerms), newCorpusStats([]*Document{doc}))
+}
+
+// scorePath scores the directory and filename of a document against the query terms
+func scorePath(doc *Document, queryTerms []QueryTerm) (float64, []string) {
 	score := 0.0
 	reasons := []string{}
 	
-	fileName := strings.ToLower(filepath.Base(filePath))
-	fileNameNoExt := strings.ToLower(strings.TrimSuffix(fileName, filepath.Ext(fileName)))
+	// The path and filename are normalized like the content, so that with
+	// FoldAccents codigo matches the directory Código
+	fileNameNoExt := doc.fieldText[FieldFileName]
 	
 	// Check directory path matches first (highest priority)
-	dirPath := strings.ToLower(filepath.Dir(filePath))
-	for _, term := range queryTerms {
+	dirPath := doc.fieldText[FieldPath]
+	for _, queryTerm := range queryTerms {
+		if !queryTerm.InField(FieldPath) {
+			continue
+		}
+		term := queryTerm.Text
 		termLower := strings.ToLower(term)
+		weight := queryTerm.weight()
 		
 		// Check if term appears as a directory component
 		dirComponents := strings.Split(dirPath, string(filepath.Separator))
 		for _, component := range dirComponents {
 			if component == termLower {
-				score += 2.5 // Very high score for exact directory match
+				score += 2.5 * weight // Very high score for exact directory match
 				reasons = append(reasons, "directory exact match '"+term+"'")
 				break
 			} else if strings.Contains(component, termLower) {
-				score += 1.8 // High score for directory contains term
+				score += 1.8 * weight // High score for directory contains term
 				reasons = append(reasons, "directory contains '"+term+"'")
 				break
 			}
@@ -106,57 +150,48 @@ func (ff *FileFinder) calculateFileScore(filePath string, queryTerms []string) (
 		
 		// Also check full directory path
 		if strings.Contains(dirPath, termLower) && !strings.Contains(strings.Join(dirComponents, ""), termLower) {
-			score += 1.2 // Medium-high score for path contains term (but not already counted above)
+			score += 1.2 * weight // Medium-high score for path contains term (but not already counted above)
 			reasons = append(reasons, "path contains '"+term+"'")
 		}
 	}
 
 	// Check filename matches
-	for _, term := range queryTerms {
+	for _, queryTerm := range queryTerms {
+		if !queryTerm.InField(FieldFileName) {
+			continue
+		}
+		term := queryTerm.Text
 		termLower := strings.ToLower(term)
+		weight := queryTerm.weight()
 		
 		// Exact filename match (highest score)
 		if fileNameNoExt == termLower {
-			score += 2.0
+			score += 2.0 * weight
 			reasons = append(reasons, "exact filename match")
 			continue
 		}
 		
 		// Filename contains term (high score) 
 		if strings.Contains(fileNameNoExt, termLower) {
-			score += 1.5
+			score += 1.5 * weight
 			reasons = append(reasons, "filename contains '"+term+"'")
 			continue
 		}
 		
 		// Filename word boundary match (medium-high score)
-		if isWordInString(fileNameNoExt, termLower) {
-			score += 1.0
+		fileNameWords := doc.fields[FieldFileName].freq
+		if fileNameWords[termLower] > 0 {
+			score += 1.0 * weight
 			reasons = append(reasons, "filename word match '"+term+"'")
-		} else {
-			// Check for partial word matches in filename
-			words := strings.FieldsFunc(fileNameNoExt, func(r rune) bool {
-				return !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'))
-			})
-			
-			for _, word := range words {
-				if len(word) < 3 || len(termLower) < 3 {
-					continue
-				}
-				// Check if term contains word or word contains term
-				if (len(termLower) > 3 && strings.Contains(termLower, word)) ||
-				   (len(word) > 3 && strings.Contains(word, termLower)) {
-					score += 0.5 // Moderate score for partial filename matches
-					reasons = append(reasons, "partial filename match '"+term+"'")
-					break
-				}
-			}
 		}
 		
 	}
-	
-	// Check file content for additional scoring
-	contentScore, contentReason := ff.scoreFileContent(filePath, queryTerms)
+
+	return score, reasons
+}
+
+// combineScores merges the path score with the content score into the final file score
+func combineScores(score float64, reasons []string, contentScore float64, contentReason string) (float64, string) {
 	score += contentScore * 0.3 // Content match weighted lower than filename match
 	if contentReason != "" {
 		reasons = append(reasons, contentReason)
@@ -176,42 +211,41 @@ func (ff *FileFinder) calculateFileScore(filePath string, queryTerms []string) (
 	return score, reason
 }
 
-// scoreFileContent scores based on file content
-func (ff *FileFinder) scoreFileContent(filePath string, queryTerms []string) (float64, string) {
-	content, err := fs.ReadFile(ff.fs, filePath)
-	if err != nil {
-		return 0, ""
-	}
-	
-	contentStr := strings.ToLower(string(content))
+// scoreContent scores the content of a document against the query terms.
+// Occurrences are weighted by the boost of the field they appear in.
+func scoreContent(doc *Document, queryTerms []QueryTerm, boosts FieldBoosts) (float64, string) {
 	score := 0.0
 	matchedTerms := 0
+	contentTerms := 0
+	var matchedFields [fieldCount]bool
 	
-	for _, term := range queryTerms {
-		termLower := strings.ToLower(term)
-		if strings.Contains(contentStr, termLower) {
-			matchedTerms++
+	for _, queryTerm := range queryTerms {
+		if !queryTerm.inContent() {
+			continue
+		}
+		if queryTerm.Expansion == "" {
+			contentTerms++ // Only terms as written count for the bonus
+		}
+		termLower := strings.ToLower(queryTerm.Text)
+		weight := queryTerm.weight()
+		// Terms match whole analyzed terms, and phrases are counted at token
+		// positions so that x-api-key matches the phrase "x api key". Only
+		// wildcards match inside words.
+		matched := false
+		for _, field := range contentFields {
+			if !queryTerm.InField(field) {
+				continue
+			}
 			// Higher score for terms that appear multiple times
-			count := strings.Count(contentStr, termLower)
-			score += float64(count) * 0.1
-		} else {
-			// Check for partial matches (term is substring of words in content)
-			// or content words are substring of term
-			words := strings.Fields(contentStr)
-			for _, word := range words {
-				cleanWord := strings.Trim(word, ".,!?:;()[]{}\"'")
-				if len(cleanWord) < 3 {
-					continue
-				}
-				
-				// Check if term contains word or word contains term
-				if (len(termLower) > 3 && strings.Contains(termLower, cleanWord)) ||
-				   (len(cleanWord) > 3 && strings.Contains(cleanWord, termLower)) {
-					score += 0.05 // Lower score for partial matches
-					break
-				}
+			if count := doc.TermFrequency(field, termLower); count > 0 {
+				score += float64(count) * 0.1 * boosts[field] * weight
+				matchedFields[field] = true
+				matched = true
 			}
 		}
+		if matched && queryTerm.Expansion == "" {
+			matchedTerms++
+		}
 	}
 	
 	if score == 0 {
@@ -219,65 +253,39 @@ func (ff *FileFinder) scoreFileContent(filePath string, queryTerms []string) (fl
 	}
 	
 	// Bonus for matching all terms
-	if matchedTerms == len(queryTerms) {
+	if matchedTerms == contentTerms && contentTerms > 0 {
 		score += 0.3
 	}
 	
 	reason := "content matches"
+	var fields []string
+	for _, field := range contentFields {
+		if matchedFields[field] && field != FieldBody {
+			fields = append(fields, field.String())
+		}
+	}
+	if len(fields) > 0 {
+		reason += " (" + strings.Join(fields, ", ") + ")"
+	}
 	
 	return score, reason
 }
 
 // Helper functions
 
+// normalizeQuery returns the normalized terms of a query that add to the score
 func normalizeQuery(query string) []string {
-	// Handle pipe-separated terms (OR logic)
-	var allTerms []string
-	if strings.Contains(query, "|") {
-		pipeTerms := strings.Split(query, "|")
-		for _, pipeTerm := range pipeTerms {
-			// Split each pipe term by spaces and add to allTerms
-			spaceTerms := strings.Fields(strings.TrimSpace(pipeTerm))
-			allTerms = append(allTerms, spaceTerms...)
-		}
-	} else {
-		// Split query into terms and clean them
-		allTerms = strings.Fields(query)
-	}
-	
-	var normalized []string
-	
-	for _, term := range allTerms {
-		term = strings.ToLower(strings.TrimSpace(term))
-		
-		// Remove common stop words that don't add value
-		if isStopWord(term) {
-			continue
-		}
-		
-		// Clean punctuation but preserve pipes for regex queries
-		cleaned := strings.Trim(term, ".,!?:;()[]{}\"'")
-		if len(cleaned) > 1 { // Ignore single characters
-			normalized = append(normalized, cleaned)
-			
-			// Add common variations/stems for better matching
-			normalized = append(normalized, generateTermVariations(cleaned)...)
-		}
-	}
-	
-	// Remove duplicates
-	seen := make(map[string]bool)
-	var unique []string
-	for _, term := range normalized {
-		if !seen[term] {
-			seen[term] = true
-			unique = append(unique, term)
-		}
+	q, err := parseQuery(query, defaultAnalyzers)
+	if err != nil {
+		return nil
 	}
-	
-	return unique
+	return q.Terms()
 }
 
+// termVariationRules describes the suffix rules applied by generateTermVariations.
+// It is recorded in saved indexes, so it must change whenever the rules do.
+var termVariationRules = []string{"-s (len>3, not -ss)", "-ing (len>5)", "-ed (len>5)"}
+
 // generateTermVariations creates common variations of a term for better matching
 func generateTermVariations(term string) []string {
 	var variations []string
@@ -304,16 +312,11 @@ func generateTermVariations(term string) []string {
 	return variations
 }
 
+// defaultStopWords are the words dropped from queries whose language is unknown
+var defaultStopWords = stopWordsOf(DefaultLanguages)
+
 func isStopWord(word string) bool {
-	stopWords := map[string]bool{
-		"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
-		"be": true, "by": true, "for": true, "from": true, "has": true, "he": true,
-		"in": true, "is": true, "it": true, "its": true, "of": true, "on": true,
-		"that": true, "the": true, "to": true, "was": true, "will": true, "with": true,
-		"como": true, "con": true, "del": true, "el": true, "en": true, "es": true,
-		"la": true, "para": true, "por": true, "que": true, "un": true, "una": true,
-	}
-	return stopWords[word]
+	return defaultStopWords[word]
 }
 
 func isDocumentationFile(path string) bool {
@@ -339,15 +342,17 @@ func isDocumentationFile(path string) bool {
 }
 
 func isWordInString(text, word string) bool {
-	// Simple word boundary check
-	words := strings.FieldsFunc(text, func(r rune) bool {
-		return !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'))
-	})
-	
-	for _, w := range words {
-		if strings.ToLower(w) == word {
+	// Word boundaries are those of the default analyzer, stems aren't words
+	for _, w := range literalTerms(defaultAnalyzer, text) {
+		if w == word {
 			return true
 		}
 	}
 	return false
-}
\ No newline at end of file
+}
+
+// isWordRune reports whether r is part of a word: a letter, a digit or a
+// combining mark such as the accent of a decomposed é
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
@@ -300,6 +300,8 @@ func TestIsWordInString(t *testing.T) {
 		{"Case insensitive", "Hello World", "hello", true},
 		{"Word boundary", "api-documentation", "api", true},
 		{"Not a word boundary", "application", "api", false},
+		{"Accented word", "Requiere autenticación previa", "autenticación", true},
+		{"Accent is part of the word", "el código fuente", "c", false},
 	}
 
 	for _, tt := range tests {
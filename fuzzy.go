@@ -0,0 +1,297 @@
+package search_engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FuzzyNode matches words within an edit distance of a term. Insertions,
+// deletions, substitutions and transpositions of adjacent letters count as one edit.
+type FuzzyNode struct {
+	Text     string // The word as written in the query
+	Term     string // Normalized term
+	Distance int    // Maximum number of edits, 1 or 2
+
+	// Expansions are the dictionary terms within Distance of Term, filled in
+	// by the engine before the query is evaluated. Truncated is set when there
+	// were more than the expansion limit.
+	Expansions []FuzzyExpansion
+	Truncated  bool
+}
+
+// FuzzyExpansion is a dictionary term matched by a fuzzy term
+type FuzzyExpansion struct {
+	Term     string
+	Distance int
+}
+
+func (n *FuzzyNode) String() string {
+	return n.Term + "~" + strconv.Itoa(n.Distance)
+}
+
+func (n *FuzzyNode) matches(doc *Document) bool {
+	return doc.containsAnyTerm(n.forms(), nil)
+}
+
+// collectTerms adds the term itself and its expansions, which weigh less the
+// more edits they need
+func (n *FuzzyNode) collectTerms(positive, negative *[]QueryTerm, negated bool) {
+	terms := []QueryTerm{{Text: n.Term}}
+	for _, exp := range n.Expansions {
+		terms = append(terms, QueryTerm{
+			Text:      exp.Term,
+			Weight:    fuzzyWeight(exp.Distance),
+			Expansion: "fuzzy",
+			Original:  n.Term,
+		})
+	}
+
+	if negated {
+		*negative = append(*negative, terms...)
+	} else {
+		*positive = append(*positive, terms...)
+	}
+}
+
+// forms returns the term and its expansions
+func (n *FuzzyNode) forms() []string {
+	forms := []string{n.Term}
+	for _, exp := range n.Expansions {
+		forms = append(forms, exp.Term)
+	}
+	return forms
+}
+
+// expand fills in the expansions from a sorted term dictionary, keeping the
+// limit closest terms
+func (n *FuzzyNode) expand(dictionary []string, limit int) {
+	n.Expansions, n.Truncated = nil, false
+	for _, term := range dictionary {
+		if term == n.Term {
+			continue
+		}
+		if d := editDistance(n.Term, term, n.Distance); d <= n.Distance {
+			n.Expansions = append(n.Expansions, FuzzyExpansion{Term: term, Distance: d})
+		}
+	}
+
+	sort.SliceStable(n.Expansions, func(i, j int) bool {
+		return n.Expansions[i].Distance < n.Expansions[j].Distance
+	})
+	if len(n.Expansions) > limit {
+		n.Expansions, n.Truncated = n.Expansions[:limit], true
+	}
+}
+
+// fuzzyWeight returns the weight of a fuzzy match, always below an exact match
+func fuzzyWeight(distance int) float64 {
+	return 1 / float64(2*distance)
+}
+
+// autoFuzzyDistance returns the edit distance tolerated for a term of a given
+// length when none is written: short words need exact matches
+func autoFuzzyDistance(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 3:
+		return 0
+	case n < 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// parseFuzzy splits a word such as vouchr~1 into the term and the distance.
+// Without a number the distance depends on the length of the term.
+func parseFuzzy(word string) (string, int, bool) {
+	i := strings.LastIndexByte(word, '~')
+	if i <= 0 {
+		return "", 0, false
+	}
+
+	term, suffix := word[:i], word[i+1:]
+	if suffix == "" {
+		return term, max(autoFuzzyDistance(term), 1), true
+	}
+
+	distance, err := strconv.Atoi(suffix)
+	if err != nil || distance < 0 {
+		return "", 0, false
+	}
+	return term, min(distance, 2), true
+}
+
+// expandQuery fills in the expansions of every fuzzy and wildcard term of the
+// query, each one limited to limit dictionary terms
+func expandQuery(q *Query, dictionary []string, limit int) {
+	walkNodes(q.Root, func(node Node) {
+		switch n := node.(type) {
+		case *FuzzyNode:
+			n.expand(dictionary, limit)
+		case *WildcardNode:
+			n.expand(dictionary, limit)
+		}
+	})
+}
+
+// truncatedExpansions describes the fuzzy and wildcard terms of the query that
+// had more matching dictionary terms than the limit
+func truncatedExpansions(q *Query) []string {
+	var truncated []string
+	walkNodes(q.Root, func(node Node) {
+		switch n := node.(type) {
+		case *FuzzyNode:
+			if n.Truncated {
+				truncated = append(truncated, fmt.Sprintf("'%s' cut short at %d terms", n, len(n.Expansions)))
+			}
+		case *WildcardNode:
+			if n.Truncated {
+				truncated = append(truncated, fmt.Sprintf("'%s' cut short at %d terms", n, len(n.Expansions)))
+			}
+		}
+	})
+	return truncated
+}
+
+// fuzzyQuery returns a copy of the query where every plain term is fuzzy, or
+// nil when no term is long enough to tolerate typos. It is used when a query
+// finds nothing.
+func fuzzyQuery(q *Query) *Query {
+	changed := false
+
+	var convert func(node Node) Node
+	convert = func(node Node) Node {
+		switch n := node.(type) {
+		case *TermNode:
+			term := n.Terms[0]
+			distance := autoFuzzyDistance(term)
+			if distance == 0 {
+				return n
+			}
+			changed = true
+			return &FuzzyNode{Text: n.Text, Term: term, Distance: distance}
+		case *FieldNode:
+			if n.Child == nil {
+				return n
+			}
+			field := *n
+			field.Child = convert(n.Child)
+			return &field
+		case *AndNode:
+			return &AndNode{Children: convertNodes(n.Children, convert)}
+		case *OrNode:
+			return &OrNode{Children: convertNodes(n.Children, convert)}
+		case *SynonymNode:
+			synonyms := *n
+			synonyms.Child = convert(n.Child)
+			return &synonyms
+		case *NotNode:
+			return n // Excluded terms stay exact
+		case *BoolNode:
+			return &BoolNode{
+				Must:    convertNodes(n.Must, convert),
+				Should:  convertNodes(n.Should, convert),
+				MustNot: n.MustNot,
+			}
+		}
+		return node
+	}
+
+	root := convert(q.Root)
+	if !changed {
+		return nil
+	}
+	fuzzy := *q
+	fuzzy.Root = root
+	return &fuzzy
+}
+
+func convertNodes(nodes []Node, convert func(Node) Node) []Node {
+	converted := make([]Node, len(nodes))
+	for i, node := range nodes {
+		converted[i] = convert(node)
+	}
+	return converted
+}
+
+// walkNodes calls fn for every node of a syntax tree, parents first
+func walkNodes(node Node, fn func(Node)) {
+	if node == nil {
+		return
+	}
+
+	fn(node)
+	switch n := node.(type) {
+	case *FieldNode:
+		walkNodes(n.Child, fn)
+	case *AndNode:
+		for _, child := range n.Children {
+			walkNodes(child, fn)
+		}
+	case *OrNode:
+		for _, child := range n.Children {
+			walkNodes(child, fn)
+		}
+	case *NotNode:
+		walkNodes(n.Child, fn)
+	case *SynonymNode:
+		walkNodes(n.Child, fn)
+		for _, child := range n.Synonyms {
+			walkNodes(child, fn)
+		}
+	case *BoolNode:
+		for _, nodes := range [][]Node{n.Must, n.Should, n.MustNot} {
+			for _, child := range nodes {
+				walkNodes(child, fn)
+			}
+		}
+	}
+}
+
+// editDistance returns the optimal string alignment distance between a and b,
+// or limit+1 as soon as it is known to exceed limit
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > limit {
+		return limit + 1
+	}
+
+	// Three rows of the dynamic programming matrix: two back, previous and current
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return prev[len(rb)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
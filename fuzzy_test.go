@@ -0,0 +1,153 @@
+package search_engine
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		limit    int
+		expected int
+	}{
+		{"voucher", "voucher", 2, 0},
+		{"vouchr", "voucher", 2, 1},
+		{"vuocher", "voucher", 2, 1},
+		{"authentcation", "authentication", 2, 1},
+		{"vocher", "vouchers", 2, 2},
+		{"api", "voucher", 2, 3},
+		{"paginacion", "paginación", 2, 1},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.limit); got != tt.expected {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestParseQuery_Fuzzy(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"vouchr~1", "vouchr~1"},
+		{"Vouch~", "vouch~1"},
+		{"authentcation~", "authentcation~2"},
+		{"vouchr~5", "vouchr~2"},
+		{"name:vouchr~1", "name:vouchr~1"},
+		{"a~b", ""}, // Not fuzzy, and both words are shorter than the analyzer keeps
+		{"api~v2", "api~v2"},
+	}
+
+	for _, tt := range tests {
+		q, _ := ParseQuery(tt.query)
+		if got := q.String(); got != tt.expected {
+			t.Errorf("ParseQuery(%q) = %s, expected %s", tt.query, got, tt.expected)
+		}
+	}
+}
+
+func TestFindRelevantFiles_Fuzzy(t *testing.T) {
+	engines := map[string]SearchEngine{"scan": NewSearchEngine(os.DirFS("testData"))}
+	indexed, err := NewIndexedSearchEngine(os.DirFS("testData"))
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+	engines["indexed"] = indexed
+
+	tests := []struct {
+		query  string
+		first  string
+		reason string
+	}{
+		{"authentcation", "api_authentication.md", "fuzzy match 'authentcation'→'authentication'"},
+		{"vouchr", "vouchers.md", "fuzzy match 'vouchr'→'voucher'"},
+		{"vouchr~1", "vouchers.md", "fuzzy match 'vouchr'→'voucher'"},
+		// api is found, but no document has both
+		{"+vouchr +api", "vouchers.md", "fuzzy match 'vouchr'→'voucher'"},
+	}
+
+	for name, engine := range engines {
+		for _, tt := range tests {
+			results, err := engine.FindRelevantFiles(tt.query, 10)
+			if err != nil {
+				t.Fatalf("%s: FindRelevantFiles(%q) error = %v", name, tt.query, err)
+			}
+			if len(results) == 0 {
+				t.Errorf("%s: FindRelevantFiles(%q) found nothing", name, tt.query)
+				continue
+			}
+			if results[0].Path != tt.first {
+				t.Errorf("%s: FindRelevantFiles(%q) first = %s, expected %s", name, tt.query, results[0].Path, tt.first)
+			}
+			if !strings.Contains(results[0].Reason, tt.reason) {
+				t.Errorf("%s: reason %q should contain %q", name, results[0].Reason, tt.reason)
+			}
+		}
+	}
+}
+
+func TestFindRelevantFiles_FuzzyRanksBelowExact(t *testing.T) {
+	testFS := fstest.MapFS{
+		"a.md": &fstest.MapFile{Data: []byte("Create a vouchor batch")},
+		"b.md": &fstest.MapFile{Data: []byte("Create a voucher")},
+	}
+
+	for _, scorer := range []Scorer{HeuristicScorer{}, NewBM25Scorer()} {
+		finder := NewFileFinderWithOptions(testFS, Options{Scorer: scorer})
+		results, err := finder.FindRelevantFiles("voucher~1", 10)
+		if err != nil {
+			t.Fatalf("FindRelevantFiles() error = %v", err)
+		}
+		if len(results) != 2 || results[0].Path != "b.md" {
+			t.Errorf("%T: expected the exact match first, got %v", scorer, results)
+		}
+	}
+}
+
+func TestFindRelevantFiles_FuzzyFallbackKeepsLanguage(t *testing.T) {
+	testFS := fstest.MapFS{
+		"en/setup.md":    &fstest.MapFile{Data: []byte("# Setup\n\nSet the servidor variable of the installer to the name of your server.")},
+		"es/servidor.md": &fstest.MapFile{Data: []byte("# Servidor\n\nLos webhooks se envían a tu servidor cada vez que cambia el estado de un pago.")},
+	}
+
+	q, err := parseQuery("cómo configurar el servidr", Options{}.analyzers())
+	if err != nil {
+		t.Fatalf("parseQuery() error = %v", err)
+	}
+	if fuzzy := fuzzyQuery(q); fuzzy == nil || fuzzy.Language != Spanish || q.Language != Spanish {
+		t.Errorf("fuzzyQuery() = %+v, expected the language of %+v", fuzzy, q)
+	}
+
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngine(testFS), "index": indexed} {
+		results, err := engine.FindRelevantFiles("servidr lang:es", 10)
+		if err != nil {
+			t.Fatalf("FindRelevantFiles() error = %v", err)
+		}
+		if len(results) != 1 || results[0].Path != "es/servidor.md" {
+			t.Errorf("%s: FindRelevantFiles(servidr lang:es) = %v, expected es/servidor.md", name, results)
+		}
+	}
+}
+
+func TestExtractRelevantContent_FuzzyFallback(t *testing.T) {
+	testFS := fstest.MapFS{
+		"vouchers.md": &fstest.MapFile{Data: []byte("# Intro\nfiller\nfiller\nfiller\nRedeem a voucher")},
+	}
+
+	content, err := NewSearchEngine(testFS).ExtractRelevantContent("vouchers.md", "redem", 0)
+	if err != nil {
+		t.Fatalf("ExtractRelevantContent() error = %v", err)
+	}
+	if content != "Redeem a voucher" {
+		t.Errorf("Expected the line with the misspelled word, got %q", content)
+	}
+}
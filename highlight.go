@@ -0,0 +1,216 @@
+package search_engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Highlight is a span of content that matches the query
+type Highlight struct {
+	Start int    `json:"start"` // Byte offset of the span in the content
+	End   int    `json:"end"`   // Byte offset right after the span
+	Term  string `json:"term"`  // Query term the span matches
+}
+
+// HighlightStyle is how ExtractRelevantContent marks the spans that match the query
+type HighlightStyle int
+
+const (
+	// HighlightNone leaves the content as it is
+	HighlightNone HighlightStyle = iota
+	// HighlightANSI colors the spans for a terminal
+	HighlightANSI
+	// HighlightMarkdown makes the spans **bold**
+	HighlightMarkdown
+)
+
+// ANSI escape sequences around highlighted spans: bold yellow
+const (
+	ansiHighlight = "\x1b[1;33m"
+	ansiReset     = "\x1b[0m"
+)
+
+var highlightStyleNames = map[HighlightStyle]string{
+	HighlightNone:     "none",
+	HighlightANSI:     "ansi",
+	HighlightMarkdown: "markdown",
+}
+
+func (s HighlightStyle) String() string {
+	if name, ok := highlightStyleNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("HighlightStyle(%d)", int(s))
+}
+
+// ParseHighlightStyle returns the highlight style with the given name: none, ansi or markdown
+func ParseHighlightStyle(name string) (HighlightStyle, error) {
+	for style, styleName := range highlightStyleNames {
+		if strings.EqualFold(strings.TrimSpace(name), styleName) {
+			return style, nil
+		}
+	}
+	return HighlightNone, fmt.Errorf("unknown highlight style %q (expected none, ansi or markdown)", name)
+}
+
+// markers returns the text written before and after a highlighted span
+func (s HighlightStyle) markers() (string, string) {
+	switch s {
+	case HighlightANSI:
+		return ansiHighlight, ansiReset
+	case HighlightMarkdown:
+		return "**", "**"
+	}
+	return "", ""
+}
+
+// Highlighted returns the content of the match with its highlights marked in the style
+func (m ContentMatch) Highlighted(style HighlightStyle) string {
+	return highlightText(m.Content, m.Highlights, style, m.codeLines)
+}
+
+// highlightText marks sorted, non-overlapping spans of a text in the style.
+// codeLines tells which lines of the text are in code blocks, where markdown
+// would show the markers as they are, so they are left unmarked.
+func highlightText(text string, highlights []Highlight, style HighlightStyle, codeLines []bool) string {
+	before, after := style.markers()
+	if before == "" || len(highlights) == 0 {
+		return text
+	}
+	if style == HighlightMarkdown {
+		// Bold doesn't show inside inline code, so the whole code span is bold
+		highlights = inlineCodeSpans(text, outsideCodeLines(text, highlights, codeLines))
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, h := range highlights {
+		if h.Start < last || h.End > len(text) {
+			continue
+		}
+		b.WriteString(text[last:h.Start])
+		b.WriteString(before)
+		b.WriteString(text[h.Start:h.End])
+		b.WriteString(after)
+		last = h.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// outsideCodeLines returns the spans that are on no line of a code block
+func outsideCodeLines(text string, highlights []Highlight, codeLines []bool) []Highlight {
+	inCode := func(offset int) bool {
+		line := strings.Count(text[:offset], "\n")
+		return line < len(codeLines) && codeLines[line]
+	}
+
+	var outside []Highlight
+	for _, h := range highlights {
+		if h.End > len(text) || inCode(h.Start) || inCode(h.End) {
+			continue
+		}
+		outside = append(outside, h)
+	}
+	return outside
+}
+
+// inlineCodeSpans widens the spans that are inside `inline code` to the whole
+// code span, backticks included
+func inlineCodeSpans(text string, highlights []Highlight) []Highlight {
+	widened := make([]Highlight, len(highlights))
+	for i, h := range highlights {
+		lineStart := strings.LastIndexByte(text[:h.Start], '\n') + 1
+		lineEnd := len(text)
+		if n := strings.IndexByte(text[h.End:], '\n'); n >= 0 {
+			lineEnd = h.End + n
+		}
+		open := strings.LastIndexByte(text[lineStart:h.Start], '`')
+		if strings.Count(text[lineStart:h.Start], "`")%2 == 1 {
+			if end := strings.IndexByte(text[h.End:lineEnd], '`'); end >= 0 {
+				h.Start, h.End = lineStart+open, h.End+end+1
+			}
+		}
+		widened[i] = h
+	}
+	return mergeHighlights(widened)
+}
+
+// highlightTerms returns the spans of a text whose tokens match the query
+// terms, analyzing the text with the analyzer of the document so that stems,
+// sub-words of identifiers and synonyms are found as they are when scoring.
+// Phrases are highlighted where all their words follow each other.
+func highlightTerms(analyzer Analyzer, text string, terms []string) []Highlight {
+	if len(terms) == 0 {
+		return nil
+	}
+
+	tokens := analyzer.Analyze(text)
+	byPosition := make(map[int][]Token)
+	for _, tok := range tokens {
+		byPosition[tok.Position] = append(byPosition[tok.Position], tok)
+	}
+	// span returns the bytes of the token of a term at a position
+	span := func(position int, term string) (int, int, bool) {
+		for _, tok := range byPosition[position] {
+			if tok.Term == term {
+				return tok.Start, tok.End, true
+			}
+		}
+		return 0, 0, false
+	}
+
+	positions := positionsOf(tokens)
+	var highlights []Highlight
+	for _, term := range terms {
+		words := strings.Fields(term)
+		for _, start := range positions.phraseStarts(words) {
+			first, _, ok := span(start, words[0])
+			_, last, okLast := span(start+len(words)-1, words[len(words)-1])
+			if ok && okLast && first < last {
+				highlights = append(highlights, Highlight{Start: first, End: last, Term: term})
+			}
+		}
+	}
+	return mergeHighlights(highlights)
+}
+
+// mergeHighlights sorts spans and merges the ones that overlap or touch, as
+// the sub-words of an identifier do, keeping the term of the longest
+func mergeHighlights(highlights []Highlight) []Highlight {
+	sort.Slice(highlights, func(i, j int) bool {
+		if highlights[i].Start != highlights[j].Start {
+			return highlights[i].Start < highlights[j].Start
+		}
+		return highlights[i].End > highlights[j].End
+	})
+
+	var merged []Highlight
+	for _, h := range highlights {
+		if n := len(merged); n > 0 && h.Start <= merged[n-1].End {
+			if h.End > merged[n-1].End {
+				if h.End-h.Start > merged[n-1].End-merged[n-1].Start {
+					merged[n-1].Term = h.Term
+				}
+				merged[n-1].End = h.End
+			}
+			continue
+		}
+		merged = append(merged, h)
+	}
+	return merged
+}
+
+// highlightRegexes returns the spans of a line matched by the regular expressions
+func highlightRegexes(line string, regexes []*RegexNode) []Highlight {
+	var highlights []Highlight
+	for _, re := range regexes {
+		for _, loc := range re.Regexp.FindAllStringIndex(line, -1) {
+			if loc[0] < loc[1] {
+				highlights = append(highlights, Highlight{Start: loc[0], End: loc[1], Term: re.String()})
+			}
+		}
+	}
+	return mergeHighlights(highlights)
+}
@@ -0,0 +1,114 @@
+package search_engine
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestExtractRelevantContent_Highlight(t *testing.T) {
+	testFS := fstest.MapFS{
+		"auth.md": &fstest.MapFile{Data: []byte("# Auth\n" +
+			"Renewing tokens: call renewToken before it expires.\n" +
+			"Sign in with your api key.")},
+	}
+	synonyms, err := ParseSynonyms(strings.NewReader("login, sign in"))
+	if err != nil {
+		t.Fatalf("ParseSynonyms() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		style    HighlightStyle
+		expected string
+	}{
+		{"stems and sub-words", "renew", HighlightMarkdown,
+			"**Renewing** tokens: call **renew**Token before it expires."},
+		{"ansi", "tokens", HighlightANSI,
+			"Renewing \x1b[1;33mtokens\x1b[0m: call renew\x1b[1;33mToken\x1b[0m before it expires."},
+		{"synonym phrase", "login", HighlightMarkdown, "**Sign in** with your api key."},
+		{"phrase", `"api key"`, HighlightMarkdown, "Sign in with your **api key**."},
+		{"regex", "/call \\w+/", HighlightMarkdown, "2: Renewing tokens: **call renewToken** before it expires."},
+		{"none", "renew", HighlightNone, "Renewing tokens: call renewToken before it expires."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewSearchEngineWithOptions(testFS, Options{Synonyms: synonyms, Highlight: tt.style})
+			content, err := engine.ExtractRelevantContent("auth.md", tt.query, 0)
+			if err != nil {
+				t.Fatalf("ExtractRelevantContent() error = %v", err)
+			}
+			if content != tt.expected {
+				t.Errorf("ExtractRelevantContent(%q) = %q, expected %q", tt.query, content, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExtractRelevantContent_HighlightCodeBlocks(t *testing.T) {
+	testFS := fstest.MapFS{
+		"tokens.md": &fstest.MapFile{Data: []byte("# Tokens\n" +
+			"Renew a token before it expires:\n" +
+			"```\n" +
+			"client.renew(token)\n" +
+			"```")},
+	}
+	engine := NewSearchEngineWithOptions(testFS, Options{Highlight: HighlightMarkdown})
+
+	// Markdown shows bold markers in code blocks as they are, so only the
+	// text around the code is marked
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"renew", "# Tokens\n**Renew** a token before it expires:\n```\nclient.renew(token)\n```"},
+		{"/renew\\(/", "4: client.renew(token)"},
+	}
+	for _, tt := range tests {
+		content, err := engine.ExtractRelevantContent("tokens.md", tt.query, 3)
+		if err != nil {
+			t.Fatalf("ExtractRelevantContent() error = %v", err)
+		}
+		if content != tt.expected {
+			t.Errorf("ExtractRelevantContent(%q) = %q, expected %q", tt.query, content, tt.expected)
+		}
+	}
+}
+
+func TestHighlightTerms(t *testing.T) {
+	text := "Create a voucherTransaction. Transactions move vouchers."
+	highlights := highlightTerms(DefaultAnalyzer(), text, []string{"transaction", "transact", "voucher"})
+
+	var spans []string
+	for _, h := range highlights {
+		spans = append(spans, text[h.Start:h.End])
+	}
+	// The sub-words of an identifier make a single span
+	if expected := "voucherTransaction Transactions vouchers"; strings.Join(spans, " ") != expected {
+		t.Errorf("highlightTerms() = %v, expected spans %q", highlights, expected)
+	}
+
+	// Bold doesn't show inside inline code, so markdown makes the code bold
+	code := "Table: `voucherTransaction`"
+	marked := highlightText(code, highlightTerms(DefaultAnalyzer(), code, []string{"transaction"}), HighlightMarkdown, nil)
+	if expected := "Table: **`voucherTransaction`**"; marked != expected {
+		t.Errorf("highlightText() = %q, expected %q", marked, expected)
+	}
+
+	merged := mergeHighlights([]Highlight{{Start: 4, End: 8, Term: "b"}, {Start: 0, End: 5, Term: "a"}, {Start: 10, End: 12, Term: "c"}})
+	if len(merged) != 2 || merged[0] != (Highlight{Start: 0, End: 8, Term: "a"}) || merged[1].Start != 10 {
+		t.Errorf("mergeHighlights() = %v", merged)
+	}
+}
+
+func TestParseHighlightStyle(t *testing.T) {
+	for _, style := range []HighlightStyle{HighlightNone, HighlightANSI, HighlightMarkdown} {
+		if got, err := ParseHighlightStyle(style.String()); err != nil || got != style {
+			t.Errorf("ParseHighlightStyle(%q) = %v, %v", style, got, err)
+		}
+	}
+	if _, err := ParseHighlightStyle("html"); err == nil {
+		t.Error("ParseHighlightStyle(html) expected an error")
+	}
+}
@@ -0,0 +1,100 @@
+package search_engine
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// IdentifierTokenizer splits text like WordTokenizer, and also splits the
+// identifiers of code and file names: createUser, HTTPServer, x_api_key and
+// x-api-key are emitted whole and as their sub-words. The whole identifier
+// shares the position of its first sub-word, so the phrase "create user"
+// matches createUser and createUser matches the words create user.
+type IdentifierTokenizer struct{}
+
+func (IdentifierTokenizer) String() string { return "identifier" }
+
+// Tokenize implements Tokenizer
+func (IdentifierTokenizer) Tokenize(text string) []Token {
+	var tokens []Token
+	position := 0
+	for _, span := range identifierSpans(text) {
+		parts := identifierParts(text, span)
+		for i, part := range parts {
+			tokens = append(tokens, Token{Term: text[part[0]:part[1]], Position: position, Start: part[0], End: part[1]})
+			if i == 0 && len(parts) > 1 {
+				tokens = append(tokens, Token{Term: text[span[0]:span[1]], Position: position, Start: span[0], End: span[1]})
+			}
+			position++
+		}
+	}
+	return tokens
+}
+
+// isIdentifierJoiner reports whether r joins the words of an identifier, as in
+// snake_case and kebab-case
+func isIdentifierJoiner(r rune) bool {
+	return r == '_' || r == '-'
+}
+
+// identifierSpans returns the byte ranges of the runs of word characters of a
+// text, where a joiner between two word characters continues the run
+func identifierSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && isIdentifierJoiner(r) {
+			next, _ := utf8.DecodeRuneInString(text[i+utf8.RuneLen(r):])
+			if isWordRune(next) {
+				continue
+			}
+		}
+		if start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// identifierParts splits the identifier at a span into its sub-words: at
+// joiners, before an upper case letter that follows a lower case letter or a
+// digit, and before the last upper case letter of an acronym followed by lower
+// case, as in HTTP|Server
+func identifierParts(text string, span [2]int) [][2]int {
+	var parts [][2]int
+	start := span[0]
+	var prev rune
+	for i, r := range text[span[0]:span[1]] {
+		i += span[0]
+		if isIdentifierJoiner(r) {
+			if i > start {
+				parts = append(parts, [2]int{start, i})
+			}
+			start = i + utf8.RuneLen(r)
+			prev = r
+			continue
+		}
+		if i > start && unicode.IsUpper(r) {
+			next, _ := utf8.DecodeRuneInString(text[i+utf8.RuneLen(r) : span[1]])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && unicode.IsLower(next)) {
+				parts = append(parts, [2]int{start, i})
+				start = i
+			}
+		}
+		prev = r
+	}
+	if start < span[1] {
+		parts = append(parts, [2]int{start, span[1]})
+	}
+	return parts
+}
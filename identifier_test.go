@@ -0,0 +1,98 @@
+package search_engine
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIdentifierTokenizer(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []Token
+	}{
+		{"createUser", []Token{
+			{Term: "create", Position: 0, Start: 0, End: 6},
+			{Term: "createUser", Position: 0, Start: 0, End: 10},
+			{Term: "User", Position: 1, Start: 6, End: 10},
+		}},
+		{"x_api-key", []Token{
+			{Term: "x", Position: 0, Start: 0, End: 1},
+			{Term: "x_api-key", Position: 0, Start: 0, End: 9},
+			{Term: "api", Position: 1, Start: 2, End: 5},
+			{Term: "key", Position: 2, Start: 6, End: 9},
+		}},
+		{"__init__ voucher", []Token{
+			{Term: "init", Position: 0, Start: 2, End: 6},
+			{Term: "voucher", Position: 1, Start: 9, End: 16},
+		}},
+	}
+
+	for _, tt := range tests {
+		if got := (IdentifierTokenizer{}).Tokenize(tt.text); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Tokenize(%q) = %+v, expected %+v", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestIdentifierParts(t *testing.T) {
+	tests := []struct {
+		identifier string
+		expected   []string
+	}{
+		{"paginationAndFiltering", []string{"pagination", "And", "Filtering"}},
+		{"HTTPServer", []string{"HTTP", "Server"}},
+		{"oauth2Token", []string{"oauth2", "Token"}},
+		{"api_paginationAndFiltering", []string{"api", "pagination", "And", "Filtering"}},
+		{"VoucherID", []string{"Voucher", "ID"}},
+		{"voucher", []string{"voucher"}},
+	}
+
+	for _, tt := range tests {
+		var parts []string
+		for _, part := range identifierParts(tt.identifier, [2]int{0, len(tt.identifier)}) {
+			parts = append(parts, tt.identifier[part[0]:part[1]])
+		}
+		if !reflect.DeepEqual(parts, tt.expected) {
+			t.Errorf("identifierParts(%q) = %v, expected %v", tt.identifier, parts, tt.expected)
+		}
+	}
+}
+
+func TestFindRelevantFiles_Identifiers(t *testing.T) {
+	testFS := fstest.MapFS{
+		"users.md":  &fstest.MapFile{Data: []byte("# Users\n\nCall `createUser` with the email.")},
+		"create.md": &fstest.MapFile{Data: []byte("# Create\n\nCreate a voucher.")},
+	}
+
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngine(testFS), "index": indexed} {
+		for _, query := range []string{"+create +user", `"create user"`, "createUser", "create_user"} {
+			results, err := engine.FindRelevantFiles(query, 10)
+			if err != nil {
+				t.Fatalf("FindRelevantFiles() error = %v", err)
+			}
+			if len(results) == 0 || results[0].Path != "users.md" {
+				t.Errorf("%s: FindRelevantFiles(%q) = %v, expected users.md first", name, query, results)
+			}
+		}
+	}
+}
+
+func TestFindRelevantFiles_FileNameParts(t *testing.T) {
+	// The filename matches through its camelCase part, not only as a substring
+	engine := NewSearchEngineWithOptions(os.DirFS("testData"), Options{Scorer: NewBM25Scorer()})
+	results, err := engine.FindRelevantFiles("filtering", 10)
+	if err != nil {
+		t.Fatalf("FindRelevantFiles() error = %v", err)
+	}
+	if len(results) == 0 || results[0].Path != "api_paginationAndFiltering.md" || !strings.Contains(results[0].Reason, "'filtering' in filename") {
+		t.Errorf("FindRelevantFiles() = %v, expected a filename match of api_paginationAndFiltering.md first", results)
+	}
+}
@@ -0,0 +1,210 @@
+package search_engine
+
+import (
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Posting records a single occurrence of a term inside an indexed document
+type Posting struct {
+	Doc      int `json:"doc"`      // Position of the document in the index
+	Line     int `json:"line"`     // Zero-based line number of the occurrence
+	Position int `json:"position"` // Token offset of the occurrence within the document
+}
+
+// Index is an inverted index over the documentation files of a filesystem.
+// It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	updateMu sync.Mutex           // Serializes Update calls
+	docs     []*Document          // Documents in walk order
+	byPath   map[string]int       // Document position by path
+	postings map[string][]Posting // Term -> occurrences, ordered by document and position
+	terms    []string             // Sorted term dictionary
+	stats    *CorpusStats         // Collection statistics used by scorers
+	trigrams map[string][]int     // Trigram of the lowercased content -> documents
+	analysis analyzers            // Analyzers of the documents
+	settings AnalyzerSettings     // Settings the analyzers were built from, saved with the index
+}
+
+// BuildIndex walks the filesystem and indexes every documentation file
+func BuildIndex(filesystem fs.FS) (*Index, error) {
+	return BuildIndexWithOptions(filesystem, Options{})
+}
+
+// BuildIndexWithOptions walks the filesystem and indexes every documentation
+// file with the analyzer of the options
+func BuildIndexWithOptions(filesystem fs.FS, opts Options) (*Index, error) {
+	analysis := opts.analyzers()
+	var docs []*Document
+
+	err := walkDocumentationFiles(filesystem, func(path string, info fs.FileInfo) {
+		docs = append(docs, readDocument(filesystem, path, info, analysis))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &Index{analysis: analysis, settings: analyzerSettings(opts)}
+	idx.setDocuments(docs)
+	return idx, nil
+}
+
+// setDocuments replaces the indexed documents and rebuilds the postings
+func (idx *Index) setDocuments(docs []*Document) {
+	byPath := make(map[string]int, len(docs))
+	postings := make(map[string][]Posting)
+
+	for i, doc := range docs {
+		byPath[doc.Path] = i
+		for term, list := range documentPostings(i, doc) {
+			postings[term] = append(postings[term], list...)
+		}
+	}
+
+	terms := make([]string, 0, len(postings))
+	for term := range postings {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	stats := newCorpusStats(docs)
+	trigrams := buildTrigrams(docs)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.docs = docs
+	idx.byPath = byPath
+	idx.postings = postings
+	idx.terms = terms
+	idx.stats = stats
+	idx.trigrams = trigrams
+}
+
+// Len returns the number of indexed documents
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Document returns the indexed document stored at path
+func (idx *Index) Document(path string) (*Document, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	i, ok := idx.byPath[path]
+	if !ok {
+		return nil, false
+	}
+	return idx.docs[i], true
+}
+
+// Postings returns every occurrence of a term. The term is matched as a whole,
+// lowercased word.
+func (idx *Index) Postings(term string) []Posting {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.postings[foldCase(term)]
+}
+
+// Terms returns the sorted term dictionary
+func (idx *Index) Terms() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.terms
+}
+
+// queryCandidates returns, in index order, every document that can satisfy the
+// query and score above zero. The regular expressions a document must match
+// narrow the candidates down through the trigram index. The caller must hold
+// the read lock.
+func (idx *Index) queryCandidates(q *Query) []*Document {
+	docs := idx.candidates(q.Terms())
+
+	regexes := regexNodes(q)
+	if len(regexes) == 0 {
+		return docs
+	}
+
+	all := make([]int, len(idx.docs))
+	for i := range all {
+		all[i] = i
+	}
+	allowed := all
+	for _, re := range regexes {
+		allowed = intersectInts(allowed, regexTrigrams(re.Regexp).docs(idx.trigrams, all))
+	}
+
+	var narrowed []*Document
+	for _, doc := range docs {
+		i := idx.byPath[doc.Path]
+		if j := sort.SearchInts(allowed, i); j < len(allowed) && allowed[j] == i {
+			narrowed = append(narrowed, doc)
+		}
+	}
+	return narrowed
+}
+
+// documentAnalyzers returns the analyzers the documents were indexed with
+func (idx *Index) documentAnalyzers() analyzers {
+	if idx.analysis.document == nil {
+		return defaultAnalyzers
+	}
+	return idx.analysis
+}
+
+// documentPostings returns the occurrences of every content term of the
+// document at position i, ordered by position
+func documentPostings(i int, doc *Document) map[string][]Posting {
+	postings := make(map[string][]Posting, len(doc.positions))
+	for term, positions := range doc.positions {
+		list := make([]Posting, len(positions))
+		for j, position := range positions {
+			list[j] = Posting{Doc: i, Line: doc.tokenLines[position], Position: position}
+		}
+		postings[term] = list
+	}
+	return postings
+}
+
+// candidates returns, in index order, every document that can score above zero
+// for the query terms. Documents left out are guaranteed to score zero.
+// The caller must hold the read lock.
+func (idx *Index) candidates(queryTerms []string) []*Document {
+	if len(queryTerms) == 0 {
+		return idx.docs // Only filters, such as ext:md
+	}
+
+	selected := make([]bool, len(idx.docs))
+
+	var terms []string
+	for _, term := range queryTerms {
+		// A phrase can only occur where each of its words does
+		terms = append(terms, strings.Fields(foldCase(term))...)
+	}
+
+	for _, term := range terms {
+		// Terms match whole indexed terms, as they do in scoreContent
+		for _, p := range idx.postings[term] {
+			selected[p.Doc] = true
+		}
+	}
+
+	pathTerms := plainQueryTerms(queryTerms)
+	var docs []*Document
+	for i, doc := range idx.docs {
+		if !selected[i] {
+			if score, _ := scorePath(doc, pathTerms); score <= 0 {
+				continue
+			}
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs
+}
@@ -0,0 +1,355 @@
+package search_engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// IndexFormatVersion is the version of the on-disk index format written by this package
+const IndexFormatVersion = 4
+
+// maxIndexHeaderSize limits the size of the JSON header of an index file, which
+// is read before anything in the file can be trusted
+const maxIndexHeaderSize = 1 << 20
+
+// indexFileMagic identifies index files
+var indexFileMagic = [8]byte{'T', 'X', 'T', 'S', 'I', 'D', 'X', 0}
+
+// Errors wrapped by IndexFileError
+var (
+	ErrIndexFormat   = errors.New("not a valid index file")
+	ErrIndexVersion  = errors.New("unsupported index format version")
+	ErrIndexSettings = errors.New("index was built with different analyzer settings")
+	ErrIndexChecksum = errors.New("index checksum mismatch")
+)
+
+// IndexFileError is returned when an index file cannot be loaded.
+// Use errors.Is with ErrIndexFormat, ErrIndexVersion, ErrIndexSettings or
+// ErrIndexChecksum to find out why.
+type IndexFileError struct {
+	Err    error  // The kind of problem
+	Detail string // Additional information
+}
+
+func (e *IndexFileError) Error() string {
+	if e.Detail == "" {
+		return "index file: " + e.Err.Error()
+	}
+	return "index file: " + e.Err.Error() + ": " + e.Detail
+}
+
+func (e *IndexFileError) Unwrap() error {
+	return e.Err
+}
+
+// AnalyzerSettings describes how documents were tokenized and queries normalized
+// when an index was built
+type AnalyzerSettings struct {
+	Tokenizer string     `json:"tokenizer"`  // Tokenizer and filters of the document analyzer
+	StopWords []string   `json:"stop_words"` // Words dropped from queries, sorted
+	StemRules []string   `json:"stem_rules"` // Stemmers of the languages
+	Languages []Language `json:"languages"`  // Languages documents are detected and stemmed in
+	// FoldAccents is whether accents were folded in documents and queries
+	FoldAccents bool `json:"fold_accents"`
+}
+
+// analyzerSettings returns the settings of an index built with the options
+func analyzerSettings(opts Options) AnalyzerSettings {
+	languages := opts.languages()
+	stopWords := opts.StopWords
+	if stopWords == nil {
+		stopWords = stopWordsOf(languages)
+	}
+	return AnalyzerSettings{
+		Tokenizer: describe(opts.analyzers().document),
+		StopWords: stopWords.sorted(),
+		StemRules: stemmerNames(stemmers(languages)),
+		Languages: languages,
+
+		FoldAccents: opts.FoldAccents,
+	}
+}
+
+// analyzesDocumentsLike reports whether the settings analyze documents as the
+// other ones do, so that an index built with either answers the same. Stop
+// words only apply to queries, which are analyzed with the options they are
+// searched with.
+func (s AnalyzerSettings) analyzesDocumentsLike(other AnalyzerSettings) bool {
+	return s.Tokenizer == other.Tokenizer && slices.Equal(s.StemRules, other.StemRules) &&
+		slices.Equal(s.Languages, other.Languages) && s.FoldAccents == other.FoldAccents
+}
+
+// indexFileHeader follows the magic and version in an index file
+type indexFileHeader struct {
+	Analyzer AnalyzerSettings `json:"analyzer"`
+	BodySize int64            `json:"body_size"` // Size of the encoded body in bytes
+	Checksum uint32           `json:"checksum"`  // CRC-32 (IEEE) of the body
+}
+
+// indexFileBody is the gob encoded content of an index file
+type indexFileBody struct {
+	Docs  []indexFileDoc
+	Terms []indexFileTerm
+}
+
+// indexFileDoc is a document of an index file. The terms of its content are
+// rebuilt from the postings rather than analyzed again when loading.
+type indexFileDoc struct {
+	Path     string
+	Content  string
+	Size     int64
+	ModTime  time.Time
+	Language Language
+	Words    []string // Terms found in the text rather than derived from it, sorted
+}
+
+type indexFileTerm struct {
+	Term     string
+	Postings []Posting
+}
+
+// Save writes the index to a file. The file is replaced atomically.
+func (idx *Index) Save(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if _, err := idx.WriteTo(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// WriteTo writes the index in the on-disk format.
+// The layout is: magic, version (uint32), header size (uint32), JSON header, gob body.
+func (idx *Index) WriteTo(w io.Writer) (int64, error) {
+	idx.mu.RLock()
+	body := indexFileBody{
+		Docs:  make([]indexFileDoc, len(idx.docs)),
+		Terms: make([]indexFileTerm, len(idx.terms)),
+	}
+	for i, doc := range idx.docs {
+		words := make([]string, 0, len(doc.words))
+		for word := range doc.words {
+			words = append(words, word)
+		}
+		sort.Strings(words)
+		body.Docs[i] = indexFileDoc{
+			Path:     doc.Path,
+			Content:  doc.Content,
+			Size:     doc.Size,
+			ModTime:  doc.ModTime,
+			Language: doc.Language,
+			Words:    words,
+		}
+	}
+	for i, term := range idx.terms {
+		body.Terms[i] = indexFileTerm{Term: term, Postings: idx.postings[term]}
+	}
+	settings := idx.settings
+	idx.mu.RUnlock()
+
+	var encoded bytes.Buffer
+	if err := gob.NewEncoder(&encoded).Encode(&body); err != nil {
+		return 0, err
+	}
+
+	header, err := json.Marshal(indexFileHeader{
+		Analyzer: settings,
+		BodySize: int64(encoded.Len()),
+		Checksum: crc32.ChecksumIEEE(encoded.Bytes()),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var prefix [16]byte
+	copy(prefix[:8], indexFileMagic[:])
+	binary.BigEndian.PutUint32(prefix[8:12], IndexFormatVersion)
+	binary.BigEndian.PutUint32(prefix[12:16], uint32(len(header)))
+
+	var written int64
+	for _, part := range [][]byte{prefix[:], header, encoded.Bytes()} {
+		n, err := w.Write(part)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// LoadIndex reads an index previously written with Save, which must have been
+// built with the default options
+func LoadIndex(path string) (*Index, error) {
+	return LoadIndexWithOptions(path, Options{})
+}
+
+// LoadIndexWithOptions reads an index previously written with Save, which must
+// have analyzed documents as the options do: with the same analyzer, languages
+// and accent folding
+func LoadIndexWithOptions(path string, opts Options) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadIndexWithOptions(bufio.NewReader(f), opts)
+}
+
+// ReadIndex reads an index in the on-disk format built with the default options
+func ReadIndex(r io.Reader) (*Index, error) {
+	return ReadIndexWithOptions(r, Options{})
+}
+
+// ReadIndexWithOptions reads an index in the on-disk format that analyzed
+// documents as the options do, and analyzes queries as the options say. The body is only decoded once its checksum is verified.
+func ReadIndexWithOptions(r io.Reader, opts Options) (*Index, error) {
+	var prefix [16]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, &IndexFileError{Err: ErrIndexFormat, Detail: "truncated header"}
+	}
+
+	if !bytes.Equal(prefix[:8], indexFileMagic[:]) {
+		return nil, &IndexFileError{Err: ErrIndexFormat, Detail: "bad magic"}
+	}
+
+	if version := binary.BigEndian.Uint32(prefix[8:12]); version != IndexFormatVersion {
+		return nil, &IndexFileError{
+			Err:    ErrIndexVersion,
+			Detail: fmt.Sprintf("file has version %d, expected %d", version, IndexFormatVersion),
+		}
+	}
+
+	headerSize := binary.BigEndian.Uint32(prefix[12:16])
+	if headerSize > maxIndexHeaderSize {
+		return nil, &IndexFileError{
+			Err:    ErrIndexFormat,
+			Detail: fmt.Sprintf("header of %d bytes exceeds the limit of %d", headerSize, maxIndexHeaderSize),
+		}
+	}
+	headerData := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, headerData); err != nil {
+		return nil, &IndexFileError{Err: ErrIndexFormat, Detail: "truncated header"}
+	}
+
+	var header indexFileHeader
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return nil, &IndexFileError{Err: ErrIndexFormat, Detail: err.Error()}
+	}
+
+	if !header.Analyzer.analyzesDocumentsLike(analyzerSettings(opts)) {
+		return nil, &IndexFileError{Err: ErrIndexSettings}
+	}
+
+	if header.BodySize < 0 {
+		return nil, &IndexFileError{Err: ErrIndexFormat, Detail: "negative body size"}
+	}
+
+	// The body grows as it is read rather than trusting the size in the header,
+	// so a truncated file is reported as a checksum mismatch
+	body, err := io.ReadAll(io.LimitReader(r, header.BodySize))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) != header.BodySize || crc32.ChecksumIEEE(body) != header.Checksum {
+		return nil, &IndexFileError{Err: ErrIndexChecksum}
+	}
+
+	var decoded indexFileBody
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(&decoded); err != nil {
+		return nil, &IndexFileError{Err: ErrIndexFormat, Detail: err.Error()}
+	}
+
+	return decoded.index(opts.analyzers(), header.Analyzer)
+}
+
+// index rebuilds an Index from its decoded file content. The documents are
+// not analyzed again: the terms of their content come from the postings.
+func (body *indexFileBody) index(analysis analyzers, settings AnalyzerSettings) (*Index, error) {
+	idx := &Index{
+		docs:     make([]*Document, len(body.Docs)),
+		byPath:   make(map[string]int, len(body.Docs)),
+		postings: make(map[string][]Posting, len(body.Terms)),
+		terms:    make([]string, len(body.Terms)),
+		analysis: analysis,
+		settings: settings,
+	}
+
+	for i, doc := range body.Docs {
+		idx.docs[i] = newDocumentText(doc.Path, doc.Content, analysis.forLanguage(doc.Language))
+		idx.docs[i].Size = doc.Size
+		idx.docs[i].ModTime = doc.ModTime
+		idx.docs[i].Language = doc.Language
+		idx.byPath[doc.Path] = i
+	}
+
+	// The tokens of every document, with the line of each
+	tokens := make([][]Token, len(idx.docs))
+	lines := make([][]int, len(idx.docs))
+	for i, term := range body.Terms {
+		for _, p := range term.Postings {
+			if p.Doc < 0 || p.Doc >= len(idx.docs) {
+				return nil, &IndexFileError{Err: ErrIndexFormat, Detail: "posting references unknown document"}
+			}
+			if p.Line < 0 || p.Line >= len(idx.docs[p.Doc].lineFields) || p.Position < 0 {
+				return nil, &IndexFileError{Err: ErrIndexFormat, Detail: "posting outside of its document"}
+			}
+			tokens[p.Doc] = append(tokens[p.Doc], Token{Term: term.Term, Position: p.Position, Derived: true})
+			lines[p.Doc] = append(lines[p.Doc], p.Line)
+		}
+		idx.terms[i] = term.Term
+		idx.postings[term.Term] = term.Postings
+	}
+
+	for i, doc := range idx.docs {
+		sort.Sort(tokensByPosition{tokens[i], lines[i]})
+		doc.setContentTokens(tokens[i], lines[i])
+		for _, word := range body.Docs[i].Words {
+			doc.words[word] = true
+		}
+	}
+	idx.stats = newCorpusStats(idx.docs)
+	idx.trigrams = buildTrigrams(idx.docs)
+
+	return idx, nil
+}
+
+// tokensByPosition sorts tokens by position along with their lines
+type tokensByPosition struct {
+	tokens []Token
+	lines  []int
+}
+
+func (t tokensByPosition) Len() int           { return len(t.tokens) }
+func (t tokensByPosition) Less(i, j int) bool { return t.tokens[i].Position < t.tokens[j].Position }
+func (t tokensByPosition) Swap(i, j int) {
+	t.tokens[i], t.tokens[j] = t.tokens[j], t.tokens[i]
+	t.lines[i], t.lines[j] = t.lines[j], t.lines[i]
+}
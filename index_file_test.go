@@ -0,0 +1,214 @@
+package search_engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIndex_SaveLoad(t *testing.T) {
+	idx, err := BuildIndex(os.DirFS("testData"))
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "docs.idx")
+	if err := idx.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := LoadIndex(path)
+	if err != nil {
+		t.Fatalf("LoadIndex() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(loaded.Terms(), idx.Terms()) {
+		t.Errorf("Loaded term dictionary differs from the original")
+	}
+	for _, term := range idx.Terms() {
+		if !reflect.DeepEqual(loaded.Postings(term), idx.Postings(term)) {
+			t.Errorf("Postings for %q differ after loading", term)
+		}
+	}
+
+	// Documents are rebuilt from the postings as they were analyzed
+	for _, doc := range idx.docs {
+		restored, ok := loaded.Document(doc.Path)
+		if !ok || !reflect.DeepEqual(restored, doc) {
+			t.Errorf("Document(%q) differs after loading", doc.Path)
+		}
+	}
+	if !reflect.DeepEqual(loaded.stats, idx.stats) {
+		t.Errorf("Corpus statistics differ after loading")
+	}
+
+	original := NewIndexedSearchEngineFromIndex(nil, idx)
+	restored := NewIndexedSearchEngineFromIndex(nil, loaded)
+	for _, query := range []string{"voucher", "authentication", "api|dates"} {
+		expected, _ := original.FindRelevantFiles(query, 10)
+		got, _ := restored.FindRelevantFiles(query, 10)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("FindRelevantFiles(%q) = %v, expected %v", query, got, expected)
+		}
+	}
+}
+
+func TestIndex_SaveLoadWithOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{Languages: []Language{English}},
+		{FoldAccents: true},
+	} {
+		idx, err := BuildIndexWithOptions(os.DirFS("testData"), opts)
+		if err != nil {
+			t.Fatalf("BuildIndexWithOptions() error = %v", err)
+		}
+
+		path := filepath.Join(t.TempDir(), "docs.idx")
+		if err := idx.Save(path); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+
+		// The default options are not the ones the index was built with
+		if _, err := LoadIndex(path); !errors.Is(err, ErrIndexSettings) {
+			t.Errorf("%+v: LoadIndex() error = %v, expected ErrIndexSettings", opts, err)
+		}
+
+		loaded, err := LoadIndexWithOptions(path, opts)
+		if err != nil {
+			t.Fatalf("%+v: LoadIndexWithOptions() error = %v", opts, err)
+		}
+		if describe(loaded.documentAnalyzers().document) != describe(idx.documentAnalyzers().document) {
+			t.Errorf("%+v: loaded index analyzes documents with %s, expected %s", opts,
+				describe(loaded.documentAnalyzers().document), describe(idx.documentAnalyzers().document))
+		}
+
+		original := NewIndexedSearchEngineFromIndex(nil, idx)
+		restored, err := NewIndexedSearchEngineFromIndexWithOptions(nil, loaded, opts)
+		if err != nil {
+			t.Fatalf("%+v: NewIndexedSearchEngineFromIndexWithOptions() error = %v", opts, err)
+		}
+		for _, query := range []string{"vouchers", "autenticacion", "la api"} {
+			expected, _ := original.FindRelevantFiles(query, 10)
+			got, _ := restored.FindRelevantFiles(query, 10)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("%+v: FindRelevantFiles(%q) = %v, expected %v", opts, query, got, expected)
+			}
+		}
+	}
+}
+
+func TestIndex_OtherStopWords(t *testing.T) {
+	idx, err := BuildIndex(os.DirFS("testData"))
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := idx.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	// Stop words only apply to queries, both the file and the engine accept other ones
+	opts := Options{StopWords: StopWords{"voucher": true}}
+	loaded, err := ReadIndexWithOptions(bytes.NewReader(buf.Bytes()), opts)
+	if err != nil {
+		t.Fatalf("ReadIndexWithOptions() error = %v", err)
+	}
+	for _, index := range []*Index{idx, loaded} {
+		engine, err := NewIndexedSearchEngineFromIndexWithOptions(nil, index, opts)
+		if err != nil {
+			t.Fatalf("NewIndexedSearchEngineFromIndexWithOptions() error = %v", err)
+		}
+		if results, _ := engine.FindRelevantFiles("voucher dates", 1); len(results) != 1 || results[0].Path != "api_dates.md" {
+			t.Errorf("FindRelevantFiles() = %v, expected api_dates.md with voucher dropped", results)
+		}
+	}
+}
+
+func TestReadIndex_Errors(t *testing.T) {
+	idx, err := BuildIndex(os.DirFS("testData"))
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := idx.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	valid := buf.Bytes()
+	headerEnd := 16 + int(binary.BigEndian.Uint32(valid[12:16]))
+
+	tests := []struct {
+		name     string
+		modify   func(data []byte) []byte
+		expected error
+	}{
+		{
+			name:     "Bad magic",
+			modify:   func(data []byte) []byte { data[0] = 'X'; return data },
+			expected: ErrIndexFormat,
+		},
+		{
+			name:     "Newer version",
+			modify:   func(data []byte) []byte { binary.BigEndian.PutUint32(data[8:12], IndexFormatVersion+1); return data },
+			expected: ErrIndexVersion,
+		},
+		{
+			name: "Different accent folding",
+			modify: func(data []byte) []byte {
+				return bytes.Replace(data, []byte(`"fold_accents":false`), []byte(`"fold_accents":true `), 1)
+			},
+			expected: ErrIndexSettings,
+		},
+		{
+			name:     "Corrupt body",
+			modify:   func(data []byte) []byte { data[headerEnd+len(data[headerEnd:])/2] ^= 0xff; return data },
+			expected: ErrIndexChecksum,
+		},
+		{
+			name:     "Truncated body",
+			modify:   func(data []byte) []byte { return data[:len(data)-10] },
+			expected: ErrIndexChecksum,
+		},
+		{
+			name:     "Huge header",
+			modify:   func(data []byte) []byte { binary.BigEndian.PutUint32(data[12:16], 0xffffffff); return data },
+			expected: ErrIndexFormat,
+		},
+		{
+			name: "Body size beyond the file",
+			modify: func(data []byte) []byte {
+				binary.BigEndian.PutUint32(data[12:16], binary.BigEndian.Uint32(data[12:16])+1)
+				return bytes.Replace(data, []byte(`"body_size":`), []byte(`"body_size":9`), 1)
+			},
+			expected: ErrIndexChecksum,
+		},
+		{
+			name:     "Empty file",
+			modify:   func(data []byte) []byte { return nil },
+			expected: ErrIndexFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.modify(append([]byte(nil), valid...))
+
+			loaded, err := ReadIndex(bytes.NewReader(data))
+			if loaded != nil {
+				t.Errorf("Expected no index to be returned")
+			}
+
+			var fileErr *IndexFileError
+			if !errors.As(err, &fileErr) {
+				t.Fatalf("Expected *IndexFileError, got %v", err)
+			}
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
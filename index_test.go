@@ -0,0 +1,158 @@
+package search_engine
+
+import (
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestBuildIndex_Postings(t *testing.T) {
+	testFS := fstest.MapFS{
+		"docs/auth.md": &fstest.MapFile{Data: []byte("# Auth\nUse the API key.\nThe key goes in a header")},
+		"docs/app.go":  &fstest.MapFile{Data: []byte("package key")},
+	}
+
+	idx, err := BuildIndex(testFS)
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+
+	if idx.Len() != 1 {
+		t.Fatalf("Expected 1 indexed document, got %d", idx.Len())
+	}
+
+	expected := []Posting{
+		{Doc: 0, Line: 1, Position: 4},
+		{Doc: 0, Line: 2, Position: 6},
+	}
+	if got := idx.Postings("Key"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Postings(key) = %v, expected %v", got, expected)
+	}
+
+	if got := idx.Postings("ke"); len(got) != 0 {
+		t.Errorf("Expected no postings for partial word, got %v", got)
+	}
+}
+
+func TestIndexedSearchEngine_MatchesScan(t *testing.T) {
+	testFS := fstest.MapFS{
+		"testData/foo/api/bar.md":        &fstest.MapFile{Data: []byte("API documentation for bar")},
+		"testData/foo/bad.md":            &fstest.MapFile{Data: []byte("Some bad documentation")},
+		"testData/api_authentication.md": &fstest.MapFile{Data: []byte("Authentication API guide")},
+		"testData/auth/user_guide.md":    &fstest.MapFile{Data: []byte("User authentication guide")},
+		"docs/api/endpoints.md":          &fstest.MapFile{Data: []byte("API endpoints documentation")},
+		"docs/setup.md":                  &fstest.MapFile{Data: []byte("Setup instructions, see api/endpoints")},
+		"config/api_config.json":         &fstest.MapFile{Data: []byte(`{"api": "config"}`)},
+		"other/random.txt":               &fstest.MapFile{Data: []byte("Random text file")},
+	}
+
+	filesystems := map[string]fs.FS{
+		"map":      testFS,
+		"testData": os.DirFS("testData"),
+	}
+
+	queries := []string{
+		"api", "authentication", "setup", "nonexistent", "api/endpoints",
+		"guides documentation", "voucher transaction", "retrieve many", "auth|guide",
+		`"retrieve many"`, `"voucher transaction"~3`, `api -"retrieve by id"`,
+		"heading:endpoints", "ext:md api", "code:curl voucher",
+		`/GET https:\/\/.*voucher/`, `/^#{2,} /`, "vouch* -/DELETE/",
+	}
+
+	for name, filesystem := range filesystems {
+		scan := NewSearchEngine(filesystem)
+		indexed, err := NewIndexedSearchEngine(filesystem)
+		if err != nil {
+			t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+		}
+
+		for _, query := range queries {
+			expected, err := scan.FindRelevantFiles(query, 10)
+			if err != nil {
+				t.Fatalf("scan FindRelevantFiles(%q) error = %v", query, err)
+			}
+			got, err := indexed.FindRelevantFiles(query, 10)
+			if err != nil {
+				t.Fatalf("indexed FindRelevantFiles(%q) error = %v", query, err)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("%s: FindRelevantFiles(%q) = %v, expected %v", name, query, got, expected)
+			}
+
+			for _, match := range expected {
+				want, _ := scan.ExtractRelevantContent(match.Path, query, 2)
+				have, err := indexed.ExtractRelevantContent(match.Path, query, 2)
+				if err != nil {
+					t.Fatalf("ExtractRelevantContent(%s) error = %v", match.Path, err)
+				}
+				if have != want {
+					t.Errorf("%s: ExtractRelevantContent(%s, %q) differs from scan", name, match.Path, query)
+				}
+			}
+		}
+	}
+}
+
+func TestIndex_Update(t *testing.T) {
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	file := func(content string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(content), ModTime: modTime}
+	}
+
+	testFS := fstest.MapFS{
+		"a.md":         file("alpha beta"),
+		"b/old.md":     file("gamma delta"),
+		"b/same.md":    file("beta epsilon"),
+		"c/changed.md": file("zeta alpha"),
+	}
+
+	idx, err := BuildIndex(testFS)
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+
+	delete(testFS, "b/old.md")
+	testFS["b/new.md"] = file("alpha theta")
+	testFS["0first.md"] = file("beta iota")
+	testFS["c/changed.md"] = &fstest.MapFile{Data: []byte("zeta kappa alpha"), ModTime: modTime.Add(time.Second)}
+
+	update, err := idx.Update(testFS)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	expectedUpdate := IndexUpdate{
+		Added:    []string{"0first.md", "b/new.md"},
+		Modified: []string{"c/changed.md"},
+		Removed:  []string{"b/old.md"},
+	}
+	if !reflect.DeepEqual(update, expectedUpdate) {
+		t.Errorf("Update() = %+v, expected %+v", update, expectedUpdate)
+	}
+
+	fresh, err := BuildIndex(testFS)
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(idx.docs, fresh.docs) {
+		t.Errorf("Updated documents differ from a fresh build")
+	}
+	if !reflect.DeepEqual(idx.postings, fresh.postings) {
+		t.Errorf("Updated postings = %v, expected %v", idx.postings, fresh.postings)
+	}
+	if !reflect.DeepEqual(idx.terms, fresh.terms) || !reflect.DeepEqual(idx.byPath, fresh.byPath) {
+		t.Errorf("Updated dictionary differs from a fresh build")
+	}
+
+	update, err = idx.Update(testFS)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !update.Empty() {
+		t.Errorf("Expected no changes on second update, got %+v", update)
+	}
+}
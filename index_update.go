@@ -0,0 +1,139 @@
+package search_engine
+
+import (
+	"io/fs"
+	"sort"
+)
+
+// IndexUpdate lists the files changed by Index.Update
+type IndexUpdate struct {
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+// Empty reports whether the update changed nothing
+func (u IndexUpdate) Empty() bool {
+	return len(u.Added) == 0 && len(u.Modified) == 0 && len(u.Removed) == 0
+}
+
+// Update brings the index in sync with the filesystem. Only files whose size or
+// modification time differ from what the index recorded are read and tokenized
+// again, and postings of deleted files are dropped. Afterwards the index is
+// identical to one built from scratch with BuildIndex.
+func (idx *Index) Update(filesystem fs.FS) (IndexUpdate, error) {
+	idx.updateMu.Lock()
+	defer idx.updateMu.Unlock()
+
+	idx.mu.RLock()
+	oldDocs := idx.docs
+	oldByPath := idx.byPath
+	oldPostings := idx.postings
+	idx.mu.RUnlock()
+
+	var update IndexUpdate
+	var docs []*Document
+	oldToNew := make([]int, len(oldDocs)) // -1 when the document was dropped or replaced
+	for i := range oldToNew {
+		oldToNew[i] = -1
+	}
+	var fresh []int // Positions of documents that need tokenizing
+
+	err := walkDocumentationFiles(filesystem, func(path string, info fs.FileInfo) {
+		i, known := oldByPath[path]
+		if known {
+			old := oldDocs[i]
+			if old.Size == info.Size() && old.ModTime.Equal(info.ModTime()) {
+				oldToNew[i] = len(docs)
+				docs = append(docs, old)
+				return
+			}
+			update.Modified = append(update.Modified, path)
+		} else {
+			update.Added = append(update.Added, path)
+		}
+
+		fresh = append(fresh, len(docs))
+		docs = append(docs, readDocument(filesystem, path, info, idx.documentAnalyzers()))
+	})
+
+	if err != nil {
+		return IndexUpdate{}, err
+	}
+
+	seen := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		seen[doc.Path] = true
+	}
+	for _, doc := range oldDocs {
+		if !seen[doc.Path] {
+			update.Removed = append(update.Removed, doc.Path)
+		}
+	}
+
+	if update.Empty() {
+		return update, nil
+	}
+
+	// Keep the postings of unchanged documents, renumbered to their new position.
+	// Renumbering preserves order because unchanged documents keep their relative
+	// walk order.
+	postings := make(map[string][]Posting, len(oldPostings))
+	for term, list := range oldPostings {
+		var kept []Posting
+		for _, p := range list {
+			if n := oldToNew[p.Doc]; n >= 0 {
+				p.Doc = n
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) > 0 {
+			postings[term] = kept
+		}
+	}
+
+	// Merge the postings of new and modified documents
+	for _, n := range fresh {
+		for term, list := range documentPostings(n, docs[n]) {
+			postings[term] = insertPostings(postings[term], list)
+		}
+	}
+
+	byPath := make(map[string]int, len(docs))
+	for i, doc := range docs {
+		byPath[doc.Path] = i
+	}
+
+	terms := make([]string, 0, len(postings))
+	for term := range postings {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	stats := newCorpusStats(docs)
+	trigrams := buildTrigrams(docs)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.docs = docs
+	idx.byPath = byPath
+	idx.postings = postings
+	idx.terms = terms
+	idx.stats = stats
+	idx.trigrams = trigrams
+
+	return update, nil
+}
+
+// insertPostings inserts the postings of a single document into a list ordered by document
+func insertPostings(list, added []Posting) []Posting {
+	at := sort.Search(len(list), func(i int) bool {
+		return list[i].Doc > added[0].Doc
+	})
+
+	merged := make([]Posting, 0, len(list)+len(added))
+	merged = append(merged, list[:at]...)
+	merged = append(merged, added...)
+	return append(merged, list[at:]...)
+}
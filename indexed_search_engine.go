@@ -0,0 +1,153 @@
+package search_engine
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// IndexedSearchEngine implements the SearchEngine interface on top of an Index.
+// It produces the same rankings as SearchEngineImpl without scanning the
+// filesystem on every query.
+type IndexedSearchEngine struct {
+	fs        fs.FS
+	index     *Index
+	scorer    Scorer
+	extractor *ContentExtractor
+	tokens    TokenCounter
+
+	maxExpansions int
+	analyzers     analyzers
+}
+
+// NewIndexedSearchEngine indexes the filesystem and returns an engine backed by that index
+func NewIndexedSearchEngine(filesystem fs.FS) (*IndexedSearchEngine, error) {
+	return NewIndexedSearchEngineWithOptions(filesystem, Options{})
+}
+
+// NewIndexedSearchEngineWithOptions indexes the filesystem and returns an engine
+// backed by that index with custom options
+func NewIndexedSearchEngineWithOptions(filesystem fs.FS, opts Options) (*IndexedSearchEngine, error) {
+	index, err := BuildIndexWithOptions(filesystem, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewIndexedSearchEngineFromIndexWithOptions(filesystem, index, opts)
+}
+
+// NewIndexedSearchEngineFromIndex creates an engine that answers queries from
+// an existing index, analyzing them with the options it was built with
+func NewIndexedSearchEngineFromIndex(filesystem fs.FS, index *Index) *IndexedSearchEngine {
+	return newIndexedSearchEngine(filesystem, index, index.documentAnalyzers(), Options{})
+}
+
+// NewIndexedSearchEngineFromIndexWithOptions creates an engine that answers
+// queries from an existing index with custom options. The options must analyze
+// documents as the index does, with the same analyzer, languages and accent
+// folding; otherwise an error wrapping ErrIndexSettings is returned.
+func NewIndexedSearchEngineFromIndexWithOptions(filesystem fs.FS, index *Index, opts Options) (*IndexedSearchEngine, error) {
+	built, wanted := index.settings, analyzerSettings(opts)
+	if !built.analyzesDocumentsLike(wanted) {
+		return nil, fmt.Errorf("%w: the index analyzes documents with %s in %v, the options with %s in %v",
+			ErrIndexSettings, built.Tokenizer, built.Languages, wanted.Tokenizer, wanted.Languages)
+	}
+
+	analysis := index.documentAnalyzers()
+	query := opts.analyzers()
+	analysis.query, analysis.queryLanguages = query.query, query.queryLanguages
+	analysis.fallbackQueries = query.fallbackQueries
+	analysis.synonyms = query.synonyms
+	return newIndexedSearchEngine(filesystem, index, analysis, opts), nil
+}
+
+// newIndexedSearchEngine creates an engine that answers queries from an index
+// with the analyzers
+func newIndexedSearchEngine(filesystem fs.FS, index *Index, analysis analyzers, opts Options) *IndexedSearchEngine {
+	extractor := NewContentExtractorWithOptions(filesystem, opts)
+	extractor.analyzers = analysis
+
+	return &IndexedSearchEngine{
+		fs:        filesystem,
+		index:     index,
+		scorer:    opts.scorer(),
+		extractor: extractor,
+		tokens:    opts.tokenCounter(),
+
+		maxExpansions: opts.maxExpansions(),
+		analyzers:     analysis,
+	}
+}
+
+// Index returns the index used by the engine
+func (se *IndexedSearchEngine) Index() *Index {
+	return se.index
+}
+
+// FindRelevantFiles implements SearchEngine.FindRelevantFiles
+func (se *IndexedSearchEngine) FindRelevantFiles(query string, maxFiles int) ([]FileMatch, error) {
+	se.index.mu.RLock()
+	defer se.index.mu.RUnlock()
+
+	q, err := parseQuery(query, se.analyzers.withFallback(se.index.stats.language))
+	if err != nil {
+		return nil, err
+	}
+
+	matches, _ := searchDocuments(q, se.index.queryCandidates, se.scorer, se.index.stats, se.maxExpansions)
+	return rankFileMatches(matches, maxFiles), nil
+}
+
+// SearchSections implements SearchEngine.SearchSections
+func (se *IndexedSearchEngine) SearchSections(query string, maxSections int) ([]SectionMatch, error) {
+	se.index.mu.RLock()
+	defer se.index.mu.RUnlock()
+
+	q, err := parseQuery(query, se.analyzers.withFallback(se.index.stats.language))
+	if err != nil {
+		return nil, err
+	}
+
+	matches, q := searchDocuments(q, se.index.queryCandidates, se.scorer, se.index.stats, se.maxExpansions)
+	docs := make([]*Document, len(matches))
+	for i, m := range matches {
+		docs[i] = se.index.docs[se.index.byPath[m.Path]]
+	}
+	return rankSectionMatches(scoreSections(q, docs, se.scorer, se.analyzers), maxSections), nil
+}
+
+// BuildContext implements SearchEngine.BuildContext
+func (se *IndexedSearchEngine) BuildContext(query string, maxTokens int) (*PackedContext, error) {
+	return buildContext(se, query, maxTokens, se.tokens)
+}
+
+// ExtractRelevantContent implements SearchEngine.ExtractRelevantContent
+func (se *IndexedSearchEngine) ExtractRelevantContent(filePath, query string, contextLines int) (string, error) {
+	doc, ok := se.index.Document(filePath)
+	if !ok {
+		// Not an indexed file, read it from the filesystem
+		return se.extractor.ExtractRelevantContent(filePath, query, contextLines)
+	}
+	return se.extractor.extractFromContent(doc.Content, query, contextLines)
+}
+
+// ExtractContentMatches implements SearchEngine.ExtractContentMatches
+func (se *IndexedSearchEngine) ExtractContentMatches(filePath, query string, contextLines int) ([]ContentMatch, error) {
+	doc, ok := se.index.Document(filePath)
+	if !ok {
+		// Not an indexed file, read it from the filesystem
+		return se.extractor.ExtractContentMatches(filePath, query, contextLines)
+	}
+	return se.extractor.matchesInContent(doc.Content, query, contextLines)
+}
+
+// GetFileContent implements SearchEngine.GetFileContent
+func (se *IndexedSearchEngine) GetFileContent(filePath string) (string, error) {
+	if doc, ok := se.index.Document(filePath); ok {
+		return doc.Content, nil
+	}
+
+	content, err := fs.ReadFile(se.fs, filePath)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
@@ -0,0 +1,169 @@
+package search_engine
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Language identification
+//
+// Languages are told apart by their character trigrams, the way most offline
+// identifiers do: every language has a profile with the frequency of the
+// trigrams of a sample text, and a text belongs to the language whose profile
+// gives its trigrams the highest probability.
+
+const (
+	// minDetectionTrigrams is the number of trigrams below which a text is too
+	// short to tell its language
+	minDetectionTrigrams = 8
+
+	// minDetectionMargin is the difference in average log probability per
+	// trigram the best language needs over the second one
+	minDetectionMargin = 0.15
+
+	// maxDetectionBytes is the length of the start of a document looked at
+	maxDetectionBytes = 8 << 10
+)
+
+// languageSamples are the texts the profiles are built from. They mix the
+// prose of guides with the vocabulary of API references.
+var languageSamples = map[Language]string{
+	English: `The API returns a list of results for each request. Use the page and
+limit parameters to move through the pages of results, and the filter parameter
+to keep only the items you need. Every request must be authenticated with the
+token that was issued when you signed in. If the token has expired, the server
+answers with an error and you should request a new one. This guide explains how
+to create, update and delete vouchers, how the transactions of a voucher are
+recorded, and which fields are required when a new product is added to the
+catalog. The following sections describe the endpoints, the parameters they
+accept and the responses they return. Fields marked as optional can be left out
+of the body of the request. When something goes wrong, check the status code and
+the message of the response before you try again. We recommend that you read
+the whole document before you start, because some of the operations cannot be
+undone. You will find examples written with curl at the end of every section.
+They show what should be sent and what you can expect to receive. Webhooks are
+sent to your endpoint whenever the state of a payment changes, and they are
+retried several times with an increasing delay until your server confirms that
+it has received them. It is important to keep your keys secret and to rotate
+them from time to time. Only the owner of the account and the users with the
+right permissions are able to see them. There is also a sandbox where you can
+test the whole integration without moving any real money.`,
+
+	Spanish: `La API devuelve una lista de resultados para cada petición. Usa los
+parámetros de página y límite para recorrer las páginas de resultados, y el
+parámetro de filtro para quedarte solo con los elementos que necesitas. Todas
+las peticiones deben estar autenticadas con el token que se obtuvo al iniciar
+sesión. Si el token ha caducado, el servidor responde con un error y debes
+solicitar uno nuevo. Esta guía explica cómo crear, actualizar y eliminar los
+vales, cómo se registran las transacciones de un vale y qué campos son
+obligatorios cuando se añade un producto nuevo al catálogo. Las siguientes
+secciones describen los puntos de acceso, los parámetros que aceptan y las
+respuestas que devuelven. Los campos marcados como opcionales se pueden omitir
+en el cuerpo de la petición. Cuando algo falla, revisa el código de estado y el
+mensaje de la respuesta antes de volver a intentarlo. Te recomendamos que leas
+todo el documento antes de empezar, porque algunas de las operaciones no se
+pueden deshacer. Encontrarás ejemplos escritos con curl al final de cada
+sección. Muestran lo que se debe enviar y lo que puedes esperar recibir. Los
+webhooks se envían a tu servidor cada vez que cambia el estado de un pago, y se
+reintentan varias veces con una espera creciente hasta que tu servidor confirma
+que los ha recibido. Es importante mantener tus claves en secreto y cambiarlas
+de vez en cuando. Solo el dueño de la cuenta y los usuarios con los permisos
+adecuados pueden verlas. También hay un entorno de pruebas donde puedes probar
+toda la integración sin mover dinero real.`,
+}
+
+// languageProfile holds the log probabilities of the character trigrams of a language
+type languageProfile struct {
+	logProb map[string]float64
+	unseen  float64 // Log probability of a trigram missing from the sample
+}
+
+// languageProfiles holds the profile of every language with a sample
+var languageProfiles = func() map[Language]languageProfile {
+	profiles := make(map[Language]languageProfile, len(languageSamples))
+	for lang, sample := range languageSamples {
+		profiles[lang] = newLanguageProfile(sample)
+	}
+	return profiles
+}()
+
+// newLanguageProfile builds the profile of a sample text, with add-one smoothing
+func newLanguageProfile(sample string) languageProfile {
+	counts := make(map[string]int)
+	total := 0
+	for _, trigram := range characterTrigrams(sample) {
+		counts[trigram]++
+		total++
+	}
+
+	denominator := float64(total + len(counts) + 1)
+	profile := languageProfile{
+		logProb: make(map[string]float64, len(counts)),
+		unseen:  math.Log(1 / denominator),
+	}
+	for trigram, count := range counts {
+		profile.logProb[trigram] = math.Log(float64(count+1) / denominator)
+	}
+	return profile
+}
+
+// characterTrigrams returns the character trigrams of the lowercased words of a text.
+// Words are padded with spaces so that their first and last letters count.
+func characterTrigrams(text string) []string {
+	var trigrams []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		padded := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			trigrams = append(trigrams, string(padded[i:i+3]))
+		}
+	}
+	return trigrams
+}
+
+// DetectLanguage returns the language a text is written in, or "" when the
+// text is too short or too mixed to tell
+func DetectLanguage(text string) Language {
+	return detectLanguage(text, DefaultLanguages)
+}
+
+// detectLanguage returns which of the candidate languages a text is written
+// in, or "" when it can't tell
+func detectLanguage(text string, candidates []Language) Language {
+	if len(text) > maxDetectionBytes {
+		text = text[:maxDetectionBytes]
+	}
+	trigrams := characterTrigrams(text)
+	if len(trigrams) < minDetectionTrigrams {
+		return ""
+	}
+
+	var best Language
+	bestScore, secondScore := math.Inf(-1), math.Inf(-1)
+	for _, lang := range candidates {
+		profile, ok := languageProfiles[lang]
+		if !ok {
+			continue
+		}
+		score := 0.0
+		for _, trigram := range trigrams {
+			if p, ok := profile.logProb[trigram]; ok {
+				score += p
+			} else {
+				score += profile.unseen
+			}
+		}
+		score /= float64(len(trigrams))
+
+		if score > bestScore {
+			best, bestScore, secondScore = lang, score, bestScore
+		} else if score > secondScore {
+			secondScore = score
+		}
+	}
+
+	if best == "" || bestScore-secondScore < minDetectionMargin {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,116 @@
+package search_engine
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected Language
+	}{
+		{"how to paginate results", English},
+		{"list all transactions", English},
+		{"cómo paginar los resultados", Spanish},
+		{"el token ha caducado", Spanish},
+		{"voucher", ""},
+		{"api key", ""},
+	}
+
+	for _, tt := range tests {
+		if got := DetectLanguage(tt.text); got != tt.expected {
+			t.Errorf("DetectLanguage(%q) = %q, expected %q", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestParseQuery_Language(t *testing.T) {
+	tests := []struct {
+		query    string
+		language Language
+		terms    []string
+	}{
+		// An English query keeps the Spanish stop word la
+		{"the la region of the account", English, []string{"la", "region", "account"}},
+		{"crear un vale para la cuenta", Spanish, []string{"crear", "cre", "vale", "val", "cuenta", "cuent"}},
+		{"la account", "", []string{"account"}},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", tt.query, err)
+		}
+		if q.Language != tt.language {
+			t.Errorf("ParseQuery(%q).Language = %q, expected %q", tt.query, q.Language, tt.language)
+		}
+		if got := q.Terms(); !reflect.DeepEqual(got, tt.terms) {
+			t.Errorf("ParseQuery(%q).Terms() = %v, expected %v", tt.query, got, tt.terms)
+		}
+	}
+}
+
+func TestFindRelevantFiles_ShortQueryLanguage(t *testing.T) {
+	testFS := fstest.MapFS{
+		"accounts.md": &fstest.MapFile{Data: []byte("# Accounts\n\nEvery account has an api token that is sent with each request.")},
+		"regions.md":  &fstest.MapFile{Data: []byte("# Regions\n\nThe LA region serves the api from the west coast of the country.")},
+		"tokens.md":   &fstest.MapFile{Data: []byte("# Tokens\n\nThe api token expires when the owner of the account changes it.")},
+	}
+
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+
+	// The query is too short to detect, so it drops the stop words of the
+	// collection, which is in English: la is kept
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngine(testFS), "index": indexed} {
+		results, err := engine.FindRelevantFiles("la api", 10)
+		if err != nil {
+			t.Fatalf("FindRelevantFiles() error = %v", err)
+		}
+		if len(results) != 3 || results[0].Path != "regions.md" {
+			t.Errorf("%s: FindRelevantFiles(la api) = %v, expected regions.md first", name, results)
+		}
+	}
+}
+
+func TestFindRelevantFiles_Language(t *testing.T) {
+	testFS := fstest.MapFS{
+		"en/webhooks.md": &fstest.MapFile{Data: []byte("# Webhooks\n\nWebhooks are sent to your server whenever the state of a payment changes.")},
+		"es/webhooks.md": &fstest.MapFile{Data: []byte("# Webhooks\n\nLos webhooks se envían a tu servidor cada vez que cambia el estado de un pago.")},
+	}
+
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngine(testFS), "index": indexed} {
+		results, err := engine.FindRelevantFiles("webhooks", 10)
+		if err != nil {
+			t.Fatalf("FindRelevantFiles() error = %v", err)
+		}
+		languages := make(map[string]Language)
+		for _, r := range results {
+			languages[r.Path] = r.Language
+		}
+		if expected := map[string]Language{"en/webhooks.md": English, "es/webhooks.md": Spanish}; !reflect.DeepEqual(languages, expected) {
+			t.Errorf("%s: languages = %v, expected %v", name, languages, expected)
+		}
+
+		results, err = engine.FindRelevantFiles("webhooks lang:es", 10)
+		if err != nil {
+			t.Fatalf("FindRelevantFiles() error = %v", err)
+		}
+		if len(results) != 1 || results[0].Path != "es/webhooks.md" {
+			t.Errorf("%s: FindRelevantFiles(lang:es) = %v, expected es/webhooks.md", name, results)
+		}
+	}
+
+	if _, err := NewSearchEngine(testFS).FindRelevantFiles("lang:fr webhooks", 10); err == nil {
+		t.Error("FindRelevantFiles(lang:fr) expected an error")
+	}
+}
@@ -0,0 +1,199 @@
+package search_engine
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Language identifies the language of a document or query by its ISO 639-1 code
+type Language string
+
+// Languages with a stemmer
+const (
+	English Language = "en"
+	Spanish Language = "es"
+)
+
+// DefaultLanguages are the languages stemmed when Options doesn't set any. Our
+// docs are bilingual, so both are on by default.
+var DefaultLanguages = []Language{English, Spanish}
+
+// languageNames maps the names accepted by ParseLanguage to languages
+var languageNames = map[string]Language{
+	"en": English, "english": English,
+	"es": Spanish, "spanish": Spanish, "español": Spanish, "espanol": Spanish,
+}
+
+// ParseLanguage returns the language for a code or name such as "es" or "spanish"
+func ParseLanguage(name string) (Language, error) {
+	if lang, ok := languageNames[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return lang, nil
+	}
+	return "", fmt.Errorf("unknown language %q (want en or es)", name)
+}
+
+// ParseLanguages parses a comma separated list of languages such as "en,es"
+func ParseLanguages(spec string) ([]Language, error) {
+	var languages []Language
+	for _, name := range strings.Split(spec, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		lang, err := ParseLanguage(name)
+		if err != nil {
+			return nil, err
+		}
+		languages = append(languages, lang)
+	}
+	return languages, nil
+}
+
+// Stemmer returns the stemmer of the language, nil when it has none
+func (l Language) Stemmer() Stemmer {
+	switch l {
+	case English:
+		return EnglishStemmer{}
+	case Spanish:
+		return SpanishStemmer{}
+	}
+	return nil
+}
+
+// StopWords returns the words of the language dropped from queries
+func (l Language) StopWords() StopWords {
+	switch l {
+	case English:
+		return englishStopWords
+	case Spanish:
+		return spanishStopWords
+	}
+	return nil
+}
+
+var (
+	englishStopWords = StopWords{
+		"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+		"be": true, "by": true, "for": true, "from": true, "has": true, "he": true,
+		"in": true, "is": true, "it": true, "its": true, "of": true, "on": true,
+		"that": true, "the": true, "to": true, "was": true, "will": true, "with": true,
+	}
+	spanishStopWords = StopWords{
+		"como": true, "con": true, "de": true, "del": true, "el": true, "en": true,
+		"es": true, "la": true, "las": true, "los": true, "para": true, "por": true,
+		"que": true, "se": true, "un": true, "una": true,
+	}
+)
+
+// stopWordsOf returns the stop words of all the languages
+func stopWordsOf(languages []Language) StopWords {
+	words := make(StopWords)
+	for _, lang := range languages {
+		for word := range lang.StopWords() {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+// stemmers returns the stemmers of the languages
+func stemmers(languages []Language) []Stemmer {
+	var result []Stemmer
+	for _, lang := range languages {
+		if stemmer := lang.Stemmer(); stemmer != nil {
+			result = append(result, stemmer)
+		}
+	}
+	return result
+}
+
+// analysisSettings are the options the default analyzers are built from
+type analysisSettings struct {
+	languages   []Language
+	foldAccents bool
+	stopWords   StopWords // nil for the stop words of the languages
+}
+
+// documentAnalyzer returns the analyzer of documents written in any of the
+// languages. Accents are folded after stemming, which needs them.
+func (s analysisSettings) documentAnalyzer() Analyzer {
+	filters := []TokenFilter{LowercaseFilter{}, StemFilter{Stemmers: stemmers(s.languages)}}
+	if s.foldAccents {
+		filters = append(filters, ASCIIFoldingFilter{})
+	}
+	return NewAnalyzer(IdentifierTokenizer{}, filters...)
+}
+
+// queryAnalyzer returns the analyzer of query words in any of the languages
+func (s analysisSettings) queryAnalyzer() Analyzer {
+	stopWords := s.stopWords
+	if stopWords == nil {
+		stopWords = stopWordsOf(s.languages)
+	}
+	filters := []TokenFilter{LowercaseFilter{}, StopWordFilter{Words: stopWords},
+		LengthFilter{Min: 2}, StemFilter{Stemmers: stemmers(s.languages)}}
+	if s.foldAccents {
+		filters = append(filters, ASCIIFoldingFilter{})
+	}
+	return NewAnalyzer(IdentifierTokenizer{}, filters...)
+}
+
+// byLanguage returns, for every language, the analyzer build returns for text
+// in that language alone
+func (s analysisSettings) byLanguage(build func(analysisSettings) Analyzer) map[Language]Analyzer {
+	analyzers := make(map[Language]Analyzer, len(s.languages))
+	for _, lang := range s.languages {
+		single := s
+		single.languages = []Language{lang}
+		analyzers[lang] = build(single)
+	}
+	return analyzers
+}
+
+// withStopWordsOf returns, for every language, the analyzer build returns for
+// text in any of the languages that only drops the stop words of that one
+func (s analysisSettings) withStopWordsOf(build func(analysisSettings) Analyzer) map[Language]Analyzer {
+	analyzers := make(map[Language]Analyzer, len(s.languages))
+	for _, lang := range s.languages {
+		single := s
+		if single.stopWords == nil {
+			single.stopWords = lang.StopWords()
+		}
+		analyzers[lang] = build(single)
+	}
+	return analyzers
+}
+
+var (
+	// frontMatterLanguage finds a lang or language key in markdown front matter
+	frontMatterLanguage = regexp.MustCompile(`(?m)^(?:lang|language):\s*["']?([A-Za-zñ]+)`)
+	// htmlLanguage finds the lang attribute of an HTML document
+	htmlLanguage = regexp.MustCompile(`(?i)<html[^>]*\slang=["']?([a-z]+)`)
+)
+
+// documentLanguage returns the language a document declares or, when it
+// declares none, the one of the candidates it is detected to be written in
+func documentLanguage(content string, candidates []Language) Language {
+	if lang := declaredLanguage(content); lang != "" {
+		return lang
+	}
+	return detectLanguage(content, candidates)
+}
+
+// declaredLanguage returns the language a document declares in its front matter
+// or html tag, or "" when it declares none we know
+func declaredLanguage(content string) Language {
+	if strings.HasPrefix(content, "---") {
+		if end := strings.Index(content[3:], "\n---"); end >= 0 {
+			if m := frontMatterLanguage.FindStringSubmatch(content[3 : 3+end]); m != nil {
+				lang, _ := ParseLanguage(m[1])
+				return lang
+			}
+		}
+	}
+	if m := htmlLanguage.FindStringSubmatch(content); m != nil {
+		lang, _ := ParseLanguage(m[1])
+		return lang
+	}
+	return ""
+}
@@ -0,0 +1,444 @@
+package search_engine
+
+import (
+	"regexp"
+	"strings"
+)
+
+// BlockKind identifies the kind of a block of markdown
+type BlockKind int
+
+const (
+	BlockParagraph BlockKind = iota // Text, quotes and anything else
+	BlockListItem                   // A list item with its continuation lines and nested lists
+	BlockTable                      // A markdown or HTML table
+	BlockCode                       // A fenced code block or an HTML <pre> or <code> block
+)
+
+// blockKindNames are the names of the block kinds
+var blockKindNames = []string{"paragraph", "list item", "table", "code"}
+
+func (k BlockKind) String() string {
+	if k < 0 || int(k) >= len(blockKindNames) {
+		return "unknown"
+	}
+	return blockKindNames[k]
+}
+
+// Block is a paragraph, list item, table or code block of a section
+type Block struct {
+	Kind      BlockKind
+	Language  string // Language of a fenced code block, such as json, "" when not given
+	StartLine int    // First line, zero-based
+	EndLine   int    // Last line, zero-based and inclusive
+	Start     int    // Byte offset of the first line in the content
+	End       int    // Byte offset right after the last line, without its newline
+}
+
+// Section is a heading with the blocks and subsections under it, up to the
+// next heading of the same or a higher level. The root section of a document
+// has level 0 and holds the text before its first heading.
+type Section struct {
+	Level     int        // Heading level from 1 to 6, 0 for the root
+	Title     string     // Heading text without markup
+	StartLine int        // Line of the heading, zero-based
+	EndLine   int        // Last line of the section and its subsections, inclusive
+	Start     int        // Byte offset of the heading in the content
+	End       int        // Byte offset right after the last line, without its newline
+	Blocks    []Block    // Blocks up to the first subsection
+	Children  []*Section // Subsections in document order
+	Parent    *Section   // Enclosing section, nil for the root
+
+	headingEnd int // Last line of the heading, which is the underline of a setext heading
+}
+
+// ParseMarkdown parses a markdown document, or an HTML one written like
+// markdown, into its tree of sections
+func ParseMarkdown(content string) *Section {
+	return parseMarkdownLines(strings.Split(content, "\n"))
+}
+
+// Breadcrumb returns the titles of the section and of the sections enclosing
+// it, outermost first
+func (s *Section) Breadcrumb() []string {
+	var titles []string
+	for ; s != nil && s.Level > 0; s = s.Parent {
+		titles = append([]string{s.Title}, titles...)
+	}
+	return titles
+}
+
+// All returns the section and all its subsections in document order
+func (s *Section) All() []*Section {
+	sections := []*Section{s}
+	for _, child := range s.Children {
+		sections = append(sections, child.All()...)
+	}
+	return sections
+}
+
+// SectionAt returns the innermost section containing a zero-based line, or
+// nil when the line is outside the section. A heading line belongs to the
+// section of its heading.
+func (s *Section) SectionAt(line int) *Section {
+	if line < s.StartLine || line > s.EndLine {
+		return nil
+	}
+	if s.Level > 0 && line == s.StartLine {
+		return s
+	}
+	for _, child := range s.Children {
+		if found := child.SectionAt(line); found != nil {
+			return found
+		}
+	}
+	return s
+}
+
+// lineFields returns the field of each of the n lines of the document whose
+// tree the section is
+func (s *Section) lineFields(n int) []Field {
+	fields := make([]Field, n)
+	for i := range fields {
+		fields[i] = FieldBody
+	}
+	set := func(from, to int, field Field) {
+		for i := from; i <= to && i < n; i++ {
+			fields[i] = field
+		}
+	}
+
+	sections := s.All()
+	for _, section := range sections {
+		for _, b := range section.Blocks {
+			switch b.Kind {
+			case BlockCode:
+				set(b.StartLine, b.EndLine, FieldCode)
+			case BlockTable:
+				set(b.StartLine, b.EndLine, FieldTable)
+			}
+		}
+	}
+
+	// Heading lines are headings even when a block starts on them. The title
+	// is the first H1, or the first heading when there is no H1.
+	var title *Section
+	for _, section := range sections {
+		if section.Level > 0 {
+			set(section.StartLine, section.headingEnd, FieldHeading)
+			if title == nil || (section.Level == 1 && title.Level > 1) {
+				title = section
+			}
+		}
+	}
+
+	if title != nil {
+		set(title.StartLine, title.StartLine, FieldTitle)
+	}
+	return fields
+}
+
+// breadcrumbSeparator separates the path and headings of a breadcrumb
+const breadcrumbSeparator = " › "
+
+// sectionBreadcrumb returns the headings leading to a section as text, such as
+// "Transaction › Endpoints"
+func sectionBreadcrumb(s *Section) string {
+	return strings.Join(sectionHeadings(s), breadcrumbSeparator)
+}
+
+// sectionHeadings returns the breadcrumb of a section without the title of a
+// document with a single H1, as the file name already stands for it
+func sectionHeadings(s *Section) []string {
+	titles := s.Breadcrumb()
+	if len(titles) > 0 {
+		top := s
+		for top.Parent != nil && top.Parent.Parent != nil {
+			top = top.Parent
+		}
+		if top.Level == 1 && top.Parent != nil && countLevel(top.Parent.Children, 1) == 1 && len(titles) > 1 {
+			titles = titles[1:]
+		}
+	}
+	return titles
+}
+
+// countLevel returns how many of the sections have the heading level
+func countLevel(sections []*Section, level int) int {
+	count := 0
+	for _, s := range sections {
+		if s.Level == level {
+			count++
+		}
+	}
+	return count
+}
+
+// markdownParser builds the section tree of a document line by line
+type markdownParser struct {
+	lines      []string
+	starts     []int    // Byte offset of every line
+	current    *Section // Innermost open section
+	block      *Block   // Open block of the current section, nil when none
+	fence      string   // Marker of the open code fence
+	html       bool     // Whether an HTML <pre> or <table> block is open
+	listIndent int      // Indentation of the marker of the open list item
+	blank      bool     // Whether a blank line follows the open list item
+}
+
+// parseMarkdownLines builds the section tree of the lines of a document
+func parseMarkdownLines(lines []string) *Section {
+	p := &markdownParser{lines: lines, starts: make([]int, len(lines)+1)}
+	for i, line := range lines {
+		p.starts[i+1] = p.starts[i] + len(line) + 1
+	}
+
+	root := &Section{headingEnd: -1}
+	p.current = root
+	// Front matter is metadata, its closing --- is not a setext underline
+	for i := frontMatterEnd(lines) + 1; i < len(lines); i++ {
+		p.parseLine(i)
+	}
+	p.finish(root, len(lines)-1)
+	return root
+}
+
+// frontMatterEnd returns the closing line of the YAML front matter a document
+// starts with, -1 when it has none
+func frontMatterEnd(lines []string) int {
+	if len(lines) == 0 || strings.TrimRight(lines[0], " \t\r") != "---" {
+		return -1
+	}
+	for i := 1; i < len(lines); i++ {
+		if end := strings.TrimRight(lines[i], " \t\r"); end == "---" || end == "..." {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseLine adds a line to the open block, or starts a new block or section
+func (p *markdownParser) parseLine(i int) {
+	p.parseText(i, p.lines[i])
+}
+
+// parseText parses the text of a line, or a part of it
+func (p *markdownParser) parseText(i int, line string) {
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case p.fence != "":
+		p.extend(i)
+		if strings.HasPrefix(trimmed, p.fence) {
+			p.fence = ""
+			p.block = nil
+		}
+	case p.html:
+		// Fences inside an HTML block are part of it
+		p.extend(i)
+		if strings.Contains(trimmed, "</pre>") || strings.Contains(trimmed, "</table>") {
+			p.html = false
+			p.block = nil
+		}
+	case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+		p.open(BlockCode, i)
+		p.block.Language = fenceLanguage(trimmed)
+		p.fence = trimmed[:3]
+	case strings.HasPrefix(trimmed, "<pre"):
+		p.open(BlockCode, i)
+		p.html = !strings.Contains(trimmed, "</pre>")
+	case strings.HasPrefix(trimmed, "<table"):
+		p.open(BlockTable, i)
+		p.html = !strings.Contains(trimmed, "</table>")
+	case strings.HasPrefix(trimmed, "|"):
+		if p.block != nil && p.block.Kind == BlockTable {
+			p.extend(i)
+		} else {
+			p.open(BlockTable, i)
+		}
+	case strings.HasPrefix(trimmed, "<code"):
+		p.open(BlockCode, i)
+		p.block = nil
+	case headingLevel(trimmed) > 0:
+		p.openSection(headingLevel(trimmed), headingTitle(line), i, i)
+		// Headings converted from other formats sometimes contain escaped new
+		// lines, followed by what should have been the next lines. Blocks
+		// such as the code fence they open are parsed, but the headings are
+		// only text of this one: a section can't start inside a line.
+		if _, escaped, found := strings.Cut(line, `\n`); found {
+			for _, text := range strings.Split(escaped, `\n`) {
+				if headingLevel(strings.TrimSpace(text)) == 0 {
+					p.parseText(i, text)
+				}
+			}
+		}
+	case isSetextUnderline(trimmed) && p.block != nil && p.block.EndLine == i-1 && p.current.headingEnd != i-1 &&
+		(p.block.Kind == BlockParagraph || p.block.Kind == BlockListItem):
+		// The previous line is the heading rather than the end of the block
+		p.dropLastLine()
+		level := 2
+		if trimmed[0] == '=' {
+			level = 1
+		}
+		p.openSection(level, headingTitle(p.lines[i-1]), i-1, i)
+	case trimmed == "":
+		if p.block != nil && p.block.Kind == BlockListItem {
+			p.blank = true
+		} else {
+			p.block = nil
+		}
+	case isListMarker(trimmed):
+		indent := indentation(line)
+		if p.block != nil && p.block.Kind == BlockListItem && indent > p.listIndent {
+			p.extend(i) // Nested list
+		} else {
+			p.open(BlockListItem, i)
+			p.listIndent = indent
+		}
+	case p.block != nil && p.block.Kind == BlockListItem:
+		if p.blank && indentation(line) <= p.listIndent {
+			p.open(BlockParagraph, i)
+		} else {
+			p.extend(i)
+		}
+	case p.block != nil && p.block.Kind == BlockParagraph:
+		p.extend(i)
+	default:
+		p.open(BlockParagraph, i)
+	}
+}
+
+// lineEnd returns the byte offset right after a line, without its newline
+func (p *markdownParser) lineEnd(i int) int {
+	return p.starts[i] + len(p.lines[i])
+}
+
+// open starts a block of the current section at a line
+func (p *markdownParser) open(kind BlockKind, i int) {
+	p.current.Blocks = append(p.current.Blocks, Block{
+		Kind:      kind,
+		StartLine: i,
+		EndLine:   i,
+		Start:     p.starts[i],
+		End:       p.lineEnd(i),
+	})
+	p.block = &p.current.Blocks[len(p.current.Blocks)-1]
+	p.blank = false
+}
+
+// extend adds a line to the open block
+func (p *markdownParser) extend(i int) {
+	p.block.EndLine = i
+	p.block.End = p.lineEnd(i)
+	if strings.TrimSpace(p.lines[i]) != "" {
+		p.blank = false
+	}
+}
+
+// dropLastLine removes the last line from the open block, and the block itself
+// when it has no other line
+func (p *markdownParser) dropLastLine() {
+	b := p.block
+	p.block = nil
+	if b.StartLine == b.EndLine {
+		p.current.Blocks = p.current.Blocks[:len(p.current.Blocks)-1]
+		return
+	}
+	b.EndLine--
+	for b.EndLine > b.StartLine && strings.TrimSpace(p.lines[b.EndLine]) == "" {
+		b.EndLine--
+	}
+	b.End = p.lineEnd(b.EndLine)
+}
+
+// openSection starts a section at a heading, as a child of the innermost open
+// section with a lower level
+func (p *markdownParser) openSection(level int, title string, start, headingEnd int) {
+	p.block = nil
+	parent := p.current
+	for parent.Level >= level {
+		parent = parent.Parent
+	}
+
+	s := &Section{
+		Level:      level,
+		Title:      title,
+		StartLine:  start,
+		Start:      p.starts[start],
+		Parent:     parent,
+		headingEnd: headingEnd,
+	}
+	parent.Children = append(parent.Children, s)
+	p.current = s
+}
+
+// finish sets where a section and its subsections end: each subsection ends
+// right before the next one
+func (p *markdownParser) finish(s *Section, endLine int) {
+	s.EndLine = endLine
+	s.End = p.lineEnd(endLine)
+	for i, child := range s.Children {
+		end := endLine
+		if i+1 < len(s.Children) {
+			// Sections never start on the same line, but an inverted
+			// range would break the byte offsets of every caller
+			end = max(s.Children[i+1].StartLine-1, child.StartLine)
+		}
+		p.finish(child, end)
+	}
+}
+
+// htmlTag matches the tags of inline HTML
+var htmlTag = regexp.MustCompile(`</?[A-Za-z][^>]*>`)
+
+// headingTitle returns the text of a heading line without its markup
+func headingTitle(line string) string {
+	title := strings.TrimSpace(line)
+	if level := headingLevel(title); level > 0 && title[0] == '#' {
+		title = strings.TrimSpace(title[level:])
+		// An optional closing sequence of #s follows a space
+		if closed := strings.TrimRight(title, "#"); closed == "" || strings.HasSuffix(closed, " ") {
+			title = closed
+		}
+	}
+
+	title, _, _ = strings.Cut(title, `\n`)
+	return strings.TrimSpace(htmlTag.ReplaceAllString(title, ""))
+}
+
+// fenceLanguage returns the language of a code fence such as ```json
+func fenceLanguage(fence string) string {
+	info := strings.TrimLeft(fence, "`~")
+	if fields := strings.Fields(info); len(fields) > 0 {
+		return strings.Trim(fields[0], "{}.")
+	}
+	return ""
+}
+
+// isListMarker reports whether a trimmed line starts a list item: -, * or +,
+// or a number followed by . or ), and then a space
+func isListMarker(trimmed string) bool {
+	if len(trimmed) >= 2 && strings.ContainsRune("-*+", rune(trimmed[0])) && trimmed[1] == ' ' {
+		return true
+	}
+	digits := len(trimmed) - len(strings.TrimLeft(trimmed, "0123456789"))
+	return digits > 0 && digits < 10 && len(trimmed) > digits+1 &&
+		(trimmed[digits] == '.' || trimmed[digits] == ')') && trimmed[digits+1] == ' '
+}
+
+// indentation returns the number of columns before the text of a line, with
+// tabs counting as four
+func indentation(line string) int {
+	columns := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			columns++
+		case '\t':
+			columns += 4
+		default:
+			return columns
+		}
+	}
+	return columns
+}
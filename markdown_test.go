@@ -0,0 +1,167 @@
+package search_engine
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	content := "Intro\n" + // 0
+		"# Vouchers\n" + // 1
+		"## Create\n" + // 2
+		"- name: the name\n" + // 3
+		"  of the voucher\n" + // 4
+		"  - nested\n" + // 5
+		"- amount\n" + // 6
+		"\n" + // 7
+		"```json\n" + // 8
+		"{\"name\": \"x\"}\n" + // 9
+		"```\n" + // 10
+		"Fields\n" + // 11
+		"------\n" + // 12
+		"| Name | Type |\n" + // 13
+		"|------|------|\n" + // 14
+		"## Delete ##\n" + // 15
+		"<h3>Errors</h3>\n" + // 16
+		"Returns 404."
+
+	root := ParseMarkdown(content)
+
+	type section struct {
+		level      int
+		title      string
+		start, end int
+		blocks     []BlockKind
+	}
+	var got []section
+	for _, s := range root.All() {
+		var kinds []BlockKind
+		for _, b := range s.Blocks {
+			kinds = append(kinds, b.Kind)
+		}
+		got = append(got, section{s.Level, s.Title, s.StartLine, s.EndLine, kinds})
+	}
+
+	expected := []section{
+		{0, "", 0, 17, []BlockKind{BlockParagraph}},
+		{1, "Vouchers", 1, 17, nil},
+		{2, "Create", 2, 10, []BlockKind{BlockListItem, BlockListItem, BlockCode}},
+		{2, "Fields", 11, 14, []BlockKind{BlockTable}},
+		{2, "Delete", 15, 17, nil},
+		{3, "Errors", 16, 17, []BlockKind{BlockParagraph}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("ParseMarkdown() sections = %v, expected %v", got, expected)
+	}
+
+	create := root.Children[0].Children[0]
+	if item := create.Blocks[0]; item.StartLine != 3 || item.EndLine != 5 || content[item.Start:item.End] != "- name: the name\n  of the voucher\n  - nested" {
+		t.Errorf("list item = %+v", item)
+	}
+	if code := create.Blocks[2]; code.Language != "json" || code.StartLine != 8 || code.EndLine != 10 {
+		t.Errorf("code block = %+v", code)
+	}
+
+	errors := root.SectionAt(17)
+	if expected := []string{"Vouchers", "Delete", "Errors"}; !reflect.DeepEqual(errors.Breadcrumb(), expected) {
+		t.Errorf("Breadcrumb() = %v, expected %v", errors.Breadcrumb(), expected)
+	}
+	if got := sectionBreadcrumb(errors); got != "Delete › Errors" {
+		t.Errorf("sectionBreadcrumb() = %q", got)
+	}
+	if got := root.SectionAt(0); got != root {
+		t.Errorf("SectionAt(0) = %+v, expected the root", got)
+	}
+}
+
+func TestParseMarkdown_EscapedNewLines(t *testing.T) {
+	content, err := os.ReadFile("testData/vouchers.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := ParseMarkdown(string(content))
+
+	// "### Endpoints\n\n#### Retrieve by ID\n```" opens the code block of the
+	// endpoint, the heading inside it is only text of Endpoints
+	transaction := root.SectionAt(37)
+	if got := sectionBreadcrumb(transaction); got != "Transaction" {
+		t.Fatalf("sectionBreadcrumb(37) = %q", got)
+	}
+	endpoints := root.SectionAt(41)
+	if got := sectionBreadcrumb(endpoints); got != "Transaction › Endpoints" {
+		t.Errorf("sectionBreadcrumb(41) = %q", got)
+	}
+	if got := sectionBreadcrumb(root.SectionAt(42)); got != "Transaction › Endpoints" {
+		t.Errorf("sectionBreadcrumb(42) = %q", got)
+	}
+	if got := sectionBreadcrumb(root.SectionAt(46)); got != "Transaction › Endpoints › Retrieve many" {
+		t.Errorf("sectionBreadcrumb(46) = %q", got)
+	}
+
+	fields := classifyLines(strings.Split(string(content), "\n"))
+	for line, expected := range map[int]Field{41: FieldHeading, 42: FieldCode, 43: FieldCode, 44: FieldBody, 62: FieldTable} {
+		if fields[line] != expected {
+			t.Errorf("line %d is %v, expected %v", line, fields[line], expected)
+		}
+	}
+}
+
+func TestParseMarkdown_Malformed(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		sections []string
+		blocks   []BlockKind
+	}{
+		{"fence in an HTML table", "<table>\n<tr><td>\n```\ncode\n```\n</td></tr>\n</table>\nAfter.",
+			nil, []BlockKind{BlockTable, BlockParagraph}},
+		{"heading after an escaped new line", "## Setup\\n## Install\ntext\n",
+			[]string{"Setup 0-2"}, nil},
+		{"setext underline after a heading line", "Intro\n## Setup\\ntext\n---\nMore.",
+			[]string{"Setup 1-3"}, []BlockKind{BlockParagraph}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := ParseMarkdown(tt.content)
+			var sections []string
+			for _, s := range root.All()[1:] {
+				if s.EndLine < s.StartLine {
+					t.Errorf("section %q ends at %d before its start %d", s.Title, s.EndLine, s.StartLine)
+				}
+				sections = append(sections, fmt.Sprintf("%s %d-%d", s.Title, s.StartLine, s.EndLine))
+			}
+			var kinds []BlockKind
+			for _, b := range root.Blocks {
+				kinds = append(kinds, b.Kind)
+			}
+			if !reflect.DeepEqual(sections, tt.sections) || !reflect.DeepEqual(kinds, tt.blocks) {
+				t.Errorf("ParseMarkdown() = %v %v, expected %v %v", sections, kinds, tt.sections, tt.blocks)
+			}
+		})
+	}
+}
+
+func TestParseMarkdown_FrontMatter(t *testing.T) {
+	content := "---\n" + // 0
+		"title: Guía\n" + // 1
+		"lang: es\n" + // 2
+		"---\n" + // 3
+		"# Autenticación\n" + // 4
+		"Envía el token."
+
+	root := ParseMarkdown(content)
+	if len(root.Blocks) != 0 || len(root.Children) != 1 {
+		t.Fatalf("ParseMarkdown() = %+v, expected only the Autenticación section", root)
+	}
+	if s := root.Children[0]; s.Title != "Autenticación" || s.Level != 1 || s.StartLine != 4 {
+		t.Errorf("section = %+v, expected Autenticación at line 4", s)
+	}
+
+	// Without its closing line, it is not front matter
+	if root := ParseMarkdown("---\ntitle: Guía\n"); len(root.Blocks) != 1 {
+		t.Errorf("ParseMarkdown() blocks = %+v, expected the text as a paragraph", root.Blocks)
+	}
+}
@@ -0,0 +1,1015 @@
+package search_engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed search query.
+//
+// The syntax is a bag of clauses, like the plain queries the engine always
+// accepted, plus operators:
+//
+//	+term          the term is required
+//	-term          the term is excluded
+//	"a b"          the words must appear in this exact order
+//	"a b"~N        the words must appear within N extra positions, in any order
+//	field:term     the term must appear in a field: path, name, ext, title,
+//	               heading, body, code or table
+//	/regexp/       the content must match a regular expression, /regexp/i
+//	               ignores case
+//	a AND b        both must match
+//	a OR b, a|b    either may match
+//	NOT a          a must not match
+//	( ... )        grouping
+//
+// Plain clauses are optional: they only add to the score. Field clauses and
+// regular expressions always restrict the results. Operator keywords must be uppercase; lowercase "and",
+// "or" and "not" are searched as words.
+//
+// A word matches a document the same way whether it is optional, required or
+// excluded: where it occurs in the path, the file name or the content, also
+// inside a longer word, so that auth matches authentication. Phrases match
+// consecutive words. So +auth keeps the documents auth scores and -auth
+// drops them.
+type Query struct {
+	Root     Node     // Syntax tree, nil when the query has no searchable terms
+	Language Language // Language the query is written in, "" when it can't be told
+}
+
+// Node is a node of a query syntax tree
+type Node interface {
+	// String returns the node in query syntax
+	String() string
+
+	// matches reports whether the document satisfies the node
+	matches(doc *Document) bool
+	// collectTerms appends the terms of the node, split into the ones that add to
+	// the score and the ones that are excluded
+	collectTerms(positive, negative *[]QueryTerm, negated bool)
+}
+
+// QueryTerm is a normalized term to score, optionally restricted to some fields
+type QueryTerm struct {
+	Text   string  // Normalized term, or the space separated words of a phrase
+	Fields []Field // Fields the term may occur in, nil for all of them
+
+	// Terms not written in the query but generated from one, such as fuzzy
+	// matches, record how and from which term. They usually weigh less.
+	Weight    float64 // Scales the contribution of the term, zero means 1
+	Expansion string  // How the term was generated, such as "fuzzy"
+	Original  string  // Query term it was generated from
+}
+
+// weight returns the factor applied to the contribution of the term
+func (t QueryTerm) weight() float64 {
+	if t.Weight == 0 {
+		return 1
+	}
+	return t.Weight
+}
+
+// InField reports whether the term may occur in a field
+func (t QueryTerm) InField(field Field) bool {
+	if t.Fields == nil {
+		return true
+	}
+	for _, f := range t.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// inContent reports whether the term may occur in the content of a document
+func (t QueryTerm) inContent() bool {
+	for _, field := range contentFields {
+		if t.InField(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// plainQueryTerms turns plain normalized terms into unrestricted query terms
+func plainQueryTerms(texts []string) []QueryTerm {
+	terms := make([]QueryTerm, len(texts))
+	for i, text := range texts {
+		terms[i] = QueryTerm{Text: text}
+	}
+	return terms
+}
+
+// TermNode matches a single word
+type TermNode struct {
+	Text  string   // The word as written in the query
+	Terms []string // Normalized forms searched for: the word and its variations
+}
+
+// PhraseNode matches words at consecutive positions, or within Slop extra
+// positions of each other in any order when Slop is greater than zero.
+// A single query word that the analyzer splits into several, such as
+// x-api-key, is a phrase too.
+type PhraseNode struct {
+	Text     string   // The phrase as written in the query, without quotes
+	Words    []string // Analyzed words of the phrase, stop words included
+	Terms    []string // Normalized words that add to the score, stop words only when alone
+	Slop     int
+	Compound bool // Written as a single word rather than in quotes
+}
+
+// FieldNode restricts a term or phrase to some fields of the document. The
+// filter operators ext and lang have no child, they compare the file extension
+// or the language of the document with Value.
+type FieldNode struct {
+	Name   string  // Operator as written in the query, lowercased
+	Value  string  // Value as written in the query
+	Fields []Field // Fields the child is restricted to
+	Child  Node    // TermNode or PhraseNode, nil for filters
+}
+
+// filterOperators are the query operators that filter documents without
+// adding terms
+var filterOperators = map[string]bool{"ext": true, "lang": true}
+
+// fieldOperators maps query operators to the fields they search
+var fieldOperators = map[string][]Field{
+	"path":     {FieldPath},
+	"name":     {FieldFileName},
+	"filename": {FieldFileName},
+	"title":    {FieldTitle},
+	"heading":  {FieldTitle, FieldHeading},
+	"headings": {FieldTitle, FieldHeading},
+	"body":     {FieldBody},
+	"code":     {FieldCode},
+	"table":    {FieldTable},
+}
+
+// AndNode matches when all children match
+type AndNode struct {
+	Children []Node
+}
+
+// OrNode matches when any child matches
+type OrNode struct {
+	Children []Node
+}
+
+// NotNode matches when its child does not
+type NotNode struct {
+	Child Node
+}
+
+// BoolNode is a bag of clauses. Must clauses are required, MustNot clauses are
+// excluded and Should clauses are optional.
+type BoolNode struct {
+	Must    []Node
+	Should  []Node
+	MustNot []Node
+}
+
+// QuerySyntaxError reports malformed query syntax, such as an unbalanced
+// parenthesis or an operator without an operand
+type QuerySyntaxError struct {
+	Query   string // The query as given
+	Problem string // What is wrong with it
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("query %q: %s", e.Query, e.Problem)
+}
+
+// ParseQuery parses a query string. Malformed syntax is reported as a
+// *QuerySyntaxError, and invalid regular expressions as errors too.
+//
+// The search engines are lenient with malformed syntax instead, so that a
+// query typed by a person always runs: unbalanced parentheses are closed or
+// ignored and dangling operators are dropped.
+func ParseQuery(query string) (*Query, error) {
+	q, syntaxErr, err := parseQueryChecked(query, defaultAnalyzers)
+	if err != nil {
+		return nil, err
+	}
+	if syntaxErr != nil {
+		return nil, syntaxErr
+	}
+	return q, nil
+}
+
+// parseQuery parses a query string leniently, analyzing its words with the
+// analyzers. Only invalid regular expressions are reported as errors.
+func parseQuery(query string, analysis analyzers) (*Query, error) {
+	q, _, err := parseQueryChecked(query, analysis)
+	return q, err
+}
+
+// parseQueryChecked parses a query string leniently and returns the first
+// syntax problem found along with the query
+func parseQueryChecked(query string, analysis analyzers) (*Query, *QuerySyntaxError, error) {
+	// Stop words and stems are those of the language of the query
+	analysis, lang := analysis.forQuery(query)
+	p := &queryParser{query: query, tokens: lexQuery(query), analysis: analysis}
+	root := p.parseBag(false)
+	if p.err != nil {
+		return nil, nil, p.err
+	}
+	return &Query{Root: root, Language: lang}, p.syntaxErr, nil
+}
+
+// Terms returns the normalized terms that add to the score, without duplicates
+func (q *Query) Terms() []string {
+	positive, _ := q.collectTerms()
+	return termTexts(positive, true)
+}
+
+// ExcludedTerms returns the normalized terms the query excludes anywhere in a
+// document, without duplicates
+func (q *Query) ExcludedTerms() []string {
+	_, negative := q.collectTerms()
+	return termTexts(negative, false)
+}
+
+// ScoringTerms returns the terms that add to the score with the fields they are
+// restricted to, without duplicates
+func (q *Query) ScoringTerms() []QueryTerm {
+	positive, _ := q.collectTerms()
+
+	seen := make(map[string]bool)
+	var unique []QueryTerm
+	for _, term := range positive {
+		key := fmt.Sprint(term.Text, term.Fields)
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
+}
+
+func (q *Query) collectTerms() ([]QueryTerm, []QueryTerm) {
+	if q.Root == nil {
+		return nil, nil
+	}
+
+	var positive, negative []QueryTerm
+	q.Root.collectTerms(&positive, &negative, false)
+	return positive, negative
+}
+
+// termTexts returns the unique texts of the terms, skipping terms restricted
+// to some fields unless scoped is set
+func termTexts(terms []QueryTerm, scoped bool) []string {
+	var texts []string
+	for _, term := range terms {
+		if scoped || term.Fields == nil {
+			texts = append(texts, term.Text)
+		}
+	}
+	return uniqueStrings(texts)
+}
+
+// Matches reports whether a document satisfies the required and excluded
+// clauses of the query. Optional clauses don't filter, they only add to the score.
+func (q *Query) Matches(doc *Document) bool {
+	switch root := q.Root.(type) {
+	case nil:
+		return false
+	case *BoolNode:
+		for _, node := range root.Must {
+			if !node.matches(doc) {
+				return false
+			}
+		}
+		for _, node := range root.MustNot {
+			if node.matches(doc) {
+				return false
+			}
+		}
+		return true
+	case *OrNode:
+		// Optional alternatives only add to the score, unless they are all filters
+		return !isFilter(root) || root.matches(doc)
+	case *TermNode, *SynonymNode:
+		return true
+	default:
+		return root.matches(doc)
+	}
+}
+
+func (q *Query) String() string {
+	if q.Root == nil {
+		return ""
+	}
+	return q.Root.String()
+}
+
+func (n *TermNode) String() string { return n.Text }
+
+func (n *TermNode) matches(doc *Document) bool {
+	return doc.containsAnyTerm(n.Terms, nil)
+}
+
+func (n *TermNode) collectTerms(positive, negative *[]QueryTerm, negated bool) {
+	terms := plainQueryTerms(n.Terms)
+	if negated {
+		*negative = append(*negative, terms...)
+	} else {
+		*positive = append(*positive, terms...)
+	}
+}
+
+func (n *PhraseNode) String() string {
+	if n.Compound {
+		return n.Text
+	}
+	s := strconv.Quote(strings.Join(n.Words, " "))
+	if n.Slop > 0 {
+		s += "~" + strconv.Itoa(n.Slop)
+	}
+	return s
+}
+
+func (n *PhraseNode) matches(doc *Document) bool {
+	if n.Slop > 0 {
+		return doc.positions.withinSlop(n.Words, n.Slop)
+	}
+	return len(doc.positions.phraseStarts(n.Words)) > 0
+}
+
+// collectTerms adds the normalized words of the phrase and, for exact phrases, the whole
+// phrase so that scorers and the content extractor can reward exact occurrences
+func (n *PhraseNode) collectTerms(positive, negative *[]QueryTerm, negated bool) {
+	phrase := QueryTerm{Text: strings.Join(n.Words, " ")}
+	if negated {
+		if n.Slop == 0 || len(n.Words) == 1 {
+			*negative = append(*negative, phrase)
+		}
+		return
+	}
+
+	if n.Slop == 0 && len(n.Words) > 1 {
+		*positive = append(*positive, phrase)
+	}
+	*positive = append(*positive, plainQueryTerms(n.Terms)...)
+}
+
+// matchesIn reports whether the phrase occurs within the fields. The fields of
+// a proximity match are not checked, only the field of an exact phrase.
+func (n *PhraseNode) matchesIn(doc *Document, fields []Field) bool {
+	if n.Slop > 0 && len(n.Words) > 1 {
+		return n.matches(doc)
+	}
+
+	phrase := strings.Join(n.Words, " ")
+	for _, field := range fields {
+		if doc.TermFrequency(field, phrase) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *FieldNode) String() string {
+	if n.Child == nil {
+		return n.Name + ":" + n.Value
+	}
+	return n.Name + ":" + n.Child.String()
+}
+
+func (n *FieldNode) matches(doc *Document) bool {
+	if n.Name == "lang" {
+		lang, err := ParseLanguage(n.Value)
+		return err == nil && doc.Language == lang
+	}
+	if n.Child == nil {
+		ext := strings.TrimPrefix(strings.ToLower(n.Value), ".")
+		return strings.TrimPrefix(strings.ToLower(filepath.Ext(doc.Path)), ".") == ext
+	}
+	return matchesInFields(n.Child, doc, n.Fields)
+}
+
+// matchesInFields reports whether the child of a field clause occurs within the fields
+func matchesInFields(node Node, doc *Document, fields []Field) bool {
+	switch n := node.(type) {
+	case *TermNode:
+		return doc.containsAnyTerm(n.Terms, fields)
+	case *FuzzyNode:
+		return doc.containsAnyTerm(n.forms(), fields)
+	case *WildcardNode:
+		return doc.containsAnyTerm(n.Expansions, fields)
+	case *PhraseNode:
+		return n.matchesIn(doc, fields)
+	case *SynonymNode:
+		if matchesInFields(n.Child, doc, fields) {
+			return true
+		}
+		for _, synonym := range n.Synonyms {
+			if matchesInFields(synonym, doc, fields) {
+				return true
+			}
+		}
+		return false
+	case *AndNode:
+		for _, child := range n.Children {
+			if !matchesInFields(child, doc, fields) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (n *FieldNode) collectTerms(positive, negative *[]QueryTerm, negated bool) {
+	if n.Child == nil {
+		return
+	}
+
+	var childPositive, childNegative []QueryTerm
+	n.Child.collectTerms(&childPositive, &childNegative, negated)
+	for _, term := range childPositive {
+		term.Fields = n.Fields
+		*positive = append(*positive, term)
+	}
+	for _, term := range childNegative {
+		term.Fields = n.Fields
+		*negative = append(*negative, term)
+	}
+}
+
+func (n *AndNode) String() string { return "(" + joinNodes(n.Children, " AND ") + ")" }
+
+func (n *AndNode) matches(doc *Document) bool {
+	for _, child := range n.Children {
+		if !child.matches(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *AndNode) collectTerms(positive, negative *[]QueryTerm, negated bool) {
+	for _, child := range n.Children {
+		child.collectTerms(positive, negative, negated)
+	}
+}
+
+func (n *OrNode) String() string { return "(" + joinNodes(n.Children, " OR ") + ")" }
+
+func (n *OrNode) matches(doc *Document) bool {
+	for _, child := range n.Children {
+		if child.matches(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *OrNode) collectTerms(positive, negative *[]QueryTerm, negated bool) {
+	for _, child := range n.Children {
+		child.collectTerms(positive, negative, negated)
+	}
+}
+
+func (n *NotNode) String() string { return "NOT " + n.Child.String() }
+
+func (n *NotNode) matches(doc *Document) bool { return !n.Child.matches(doc) }
+
+func (n *NotNode) collectTerms(positive, negative *[]QueryTerm, negated bool) {
+	n.Child.collectTerms(positive, negative, !negated)
+}
+
+func (n *BoolNode) String() string {
+	var parts []string
+	for _, node := range n.Must {
+		parts = append(parts, "+"+node.String())
+	}
+	for _, node := range n.Should {
+		parts = append(parts, node.String())
+	}
+	for _, node := range n.MustNot {
+		parts = append(parts, "-"+node.String())
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func (n *BoolNode) matches(doc *Document) bool {
+	for _, node := range n.Must {
+		if !node.matches(doc) {
+			return false
+		}
+	}
+	for _, node := range n.MustNot {
+		if node.matches(doc) {
+			return false
+		}
+	}
+	if len(n.Must) > 0 || len(n.Should) == 0 {
+		return true
+	}
+	for _, node := range n.Should {
+		if node.matches(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *BoolNode) collectTerms(positive, negative *[]QueryTerm, negated bool) {
+	for _, node := range n.Must {
+		node.collectTerms(positive, negative, negated)
+	}
+	for _, node := range n.Should {
+		node.collectTerms(positive, negative, negated)
+	}
+	for _, node := range n.MustNot {
+		node.collectTerms(positive, negative, !negated)
+	}
+}
+
+// isFilter reports whether a clause restricts the results even when optional.
+// An OR of filters, such as ext:yaml|ext:yml, is a filter too.
+func isFilter(node Node) bool {
+	switch n := node.(type) {
+	case *FieldNode, *RegexNode:
+		return true
+	case *OrNode:
+		for _, child := range n.Children {
+			if !isFilter(child) {
+				return false
+			}
+		}
+		return len(n.Children) > 0
+	}
+	return false
+}
+
+// hasFilter reports whether a node requires a filter clause to match
+func hasFilter(node Node) bool {
+	switch n := node.(type) {
+	case *FieldNode, *RegexNode:
+		return true
+	case *OrNode:
+		return isFilter(n)
+	case *AndNode:
+		for _, child := range n.Children {
+			if hasFilter(child) {
+				return true
+			}
+		}
+	case *BoolNode:
+		for _, child := range n.Must {
+			if hasFilter(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func joinNodes(nodes []Node, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		parts[i] = node.String()
+	}
+	return strings.Join(parts, sep)
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// Query lexer
+
+type queryTokenKind int
+
+const (
+	queryWord queryTokenKind = iota
+	queryLParen
+	queryRParen
+	queryAnd
+	queryOr
+	queryNot
+	queryPlus
+	queryMinus
+	queryPhrase
+	queryRegex
+)
+
+type queryToken struct {
+	kind  queryTokenKind
+	text  string
+	slop  int    // Proximity of a phrase
+	flags string // Flags of a regular expression
+}
+
+// lexQuery splits a query into words and operators
+func lexQuery(query string) []queryToken {
+	var tokens []queryToken
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: queryLParen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: queryRParen, text: ")"})
+			i++
+		case r == '|':
+			tokens = append(tokens, queryToken{kind: queryOr, text: "|"})
+			i++
+		case r == '"':
+			// A phrase runs to the next quote, or to the end of the query
+			i++
+			start := i
+			for i < len(runes) && runes[i] != '"' {
+				i++
+			}
+			tok := queryToken{kind: queryPhrase, text: string(runes[start:i])}
+			if i < len(runes) {
+				i++
+			}
+
+			// An optional ~N suffix sets the proximity
+			if i+1 < len(runes) && runes[i] == '~' && unicode.IsDigit(runes[i+1]) {
+				i++
+				digits := i
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+				tok.slop, _ = strconv.Atoi(string(runes[digits:i]))
+			}
+			tokens = append(tokens, tok)
+		case (r == '+' || r == '-') && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) &&
+			!strings.ContainsRune("+-|)", runes[i+1]):
+			// A sign directly in front of a clause marks it required or excluded
+			kind := queryPlus
+			if r == '-' {
+				kind = queryMinus
+			}
+			tokens = append(tokens, queryToken{kind: kind, text: string(r)})
+			i++
+		default:
+			if r == '/' {
+				if source, flags, end, ok := lexRegex(runes, i); ok {
+					tokens = append(tokens, queryToken{kind: queryRegex, text: source, flags: flags})
+					i = end
+					continue
+				}
+			}
+
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("()|\"", runes[i]) {
+				i++
+			}
+			word := string(runes[start:i])
+
+			kind := queryWord
+			switch word {
+			case "AND":
+				kind = queryAnd
+			case "OR":
+				kind = queryOr
+			case "NOT":
+				kind = queryNot
+			}
+			tokens = append(tokens, queryToken{kind: kind, text: word})
+		}
+	}
+
+	return tokens
+}
+
+// Query parser
+//
+//	bag     := clause*
+//	clause  := ('+' | '-')? or
+//	or      := and (('OR' | '|') and)*
+//	and     := unary ('AND' unary)*
+//	unary   := ('NOT' | '+' | '-') unary | primary
+//	primary := '(' bag ')' | '"' words '"' ('~' N)? | '/' regexp '/' | word
+type queryParser struct {
+	query     string
+	tokens    []queryToken
+	pos       int
+	err       error             // First invalid regular expression
+	syntaxErr *QuerySyntaxError // First syntax problem, worked around
+	analysis  analyzers
+}
+
+// malformed records a syntax problem. Only the first one is reported.
+func (p *queryParser) malformed(problem string) {
+	if p.syntaxErr == nil {
+		p.syntaxErr = &QuerySyntaxError{Query: p.query, Problem: problem}
+	}
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) parseBag(nested bool) Node {
+	bag := &BoolNode{}
+
+	for {
+		tok, ok := p.peek()
+		if !ok {
+			break
+		}
+
+		switch tok.kind {
+		case queryRParen:
+			if nested {
+				return simplifyBag(bag)
+			}
+			p.malformed("unbalanced )")
+			p.pos++ // Stray closing parenthesis
+			continue
+		case queryAnd, queryOr:
+			p.malformed(tok.text + " without a left operand")
+			p.pos++
+			continue
+		}
+
+		sign := queryWord
+		if tok.kind == queryPlus || tok.kind == queryMinus {
+			sign = tok.kind
+			p.pos++
+		}
+
+		node := p.parseOr()
+		if node == nil {
+			continue
+		}
+
+		switch {
+		case sign == queryPlus:
+			bag.Must = append(bag.Must, node)
+		case sign == queryMinus:
+			bag.MustNot = append(bag.MustNot, node)
+		default:
+			if not, ok := node.(*NotNode); ok {
+				bag.MustNot = append(bag.MustNot, not.Child)
+			} else if isFilter(node) {
+				bag.Must = append(bag.Must, node)
+			} else {
+				bag.Should = append(bag.Should, node)
+			}
+		}
+	}
+
+	return simplifyBag(bag)
+}
+
+// simplifyBag returns nil for an empty bag and the clause itself for a single
+// optional clause or a single filter
+func simplifyBag(bag *BoolNode) Node {
+	switch {
+	case len(bag.Must)+len(bag.Should)+len(bag.MustNot) == 0:
+		return nil
+	case len(bag.Must) == 0 && len(bag.MustNot) == 0 && len(bag.Should) == 1:
+		return bag.Should[0]
+	case len(bag.Must) == 1 && len(bag.MustNot) == 0 && len(bag.Should) == 0 && isFilter(bag.Must[0]):
+		return bag.Must[0]
+	}
+	return bag
+}
+
+func (p *queryParser) parseOr() Node {
+	var children []Node
+	if node := p.parseAnd(); node != nil {
+		children = append(children, node)
+	}
+
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != queryOr {
+			break
+		}
+		p.pos++
+		if p.operandMissing(tok) {
+			continue
+		}
+		if node := p.parseAnd(); node != nil {
+			children = append(children, node)
+		}
+	}
+
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		return children[0]
+	}
+	return &OrNode{Children: children}
+}
+
+func (p *queryParser) parseAnd() Node {
+	var children []Node
+	if node := p.parseUnary(); node != nil {
+		children = append(children, node)
+	}
+
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != queryAnd {
+			break
+		}
+		p.pos++
+		if p.operandMissing(tok) {
+			continue
+		}
+		if node := p.parseUnary(); node != nil {
+			children = append(children, node)
+		}
+	}
+
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		return children[0]
+	}
+	return &AndNode{Children: children}
+}
+
+func (p *queryParser) parseUnary() Node {
+	tok, ok := p.peek()
+	if !ok {
+		return nil
+	}
+
+	switch tok.kind {
+	case queryNot, queryMinus:
+		p.pos++
+		if p.operandMissing(tok) {
+			return nil
+		}
+		child := p.parseUnary()
+		if child == nil {
+			return nil
+		}
+		return &NotNode{Child: child}
+	case queryPlus:
+		p.pos++
+		return p.parseUnary()
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() Node {
+	tok, ok := p.peek()
+	if !ok {
+		return nil
+	}
+
+	switch tok.kind {
+	case queryLParen:
+		p.pos++
+		node := p.parseBag(true)
+		if tok, ok := p.peek(); ok && tok.kind == queryRParen {
+			p.pos++
+		} else {
+			p.malformed("unbalanced (")
+		}
+		return node
+	case queryWord:
+		if node := p.synonymRun(); node != nil {
+			return node
+		}
+		p.pos++
+		if node, ok := p.parseField(tok.text); ok {
+			return node
+		}
+		return p.wordNode(tok.text)
+	case queryRegex:
+		p.pos++
+		node, err := newRegexNode(tok.text, tok.flags)
+		if err != nil {
+			if p.err == nil {
+				p.err = err
+			}
+			return nil
+		}
+		return node
+	case queryPhrase:
+		p.pos++
+		words := analyzeWords(p.analysis.document, tok.text)
+		if len(words) == 0 {
+			return nil
+		}
+		// Stop words count inside a phrase: "it department" searches for it
+		// followed by department. They only add to the score on their own
+		// when quoted alone, as in "it".
+		analyzer := p.analysis.query
+		if len(words) == 1 {
+			analyzer = withoutStopWords(analyzer)
+		}
+		terms := uniqueStrings(analyzeTerms(analyzer, tok.text))
+		return p.synonymNode(&PhraseNode{Text: tok.text, Words: words, Terms: terms, Slop: tok.slop}, tok.text)
+	}
+
+	// Operators where a clause was expected are ignored, except a closing
+	// parenthesis which belongs to the enclosing group
+	if tok.kind != queryRParen {
+		p.malformed("unexpected " + tok.text)
+		p.pos++
+	}
+	return nil
+}
+
+// operandMissing reports, and records as malformed, an operator that was just
+// read and that nothing follows but the end of the query or of a group
+func (p *queryParser) operandMissing(operator queryToken) bool {
+	if tok, ok := p.peek(); ok && tok.kind != queryRParen {
+		return false
+	}
+	p.malformed(operator.text + " without an operand")
+	return true
+}
+
+// parseField parses a field clause such as heading:fields or code:"curl -X".
+// Words with an unknown operator are not field clauses.
+func (p *queryParser) parseField(word string) (Node, bool) {
+	name, value, found := strings.Cut(word, ":")
+	name = strings.ToLower(name)
+	fields, known := fieldOperators[name]
+	if !found || (!known && !filterOperators[name]) {
+		return nil, false
+	}
+
+	if value == "" {
+		// The value may be a phrase right after the colon
+		tok, ok := p.peek()
+		if !ok || tok.kind != queryPhrase {
+			return nil, true
+		}
+		value = tok.text
+		child := p.parsePrimary()
+		if child == nil || filterOperators[name] {
+			return nil, true
+		}
+		return &FieldNode{Name: name, Value: value, Fields: fields, Child: child}, true
+	}
+
+	if name == "lang" {
+		if _, err := ParseLanguage(value); err != nil && p.err == nil {
+			p.err = err
+		}
+	}
+	if filterOperators[name] {
+		return &FieldNode{Name: name, Value: value}, true
+	}
+
+	child := p.wordNode(value)
+	if child == nil {
+		return nil, true
+	}
+	return &FieldNode{Name: name, Value: value, Fields: fields, Child: child}, true
+}
+
+// wordNode parses a single query word: a term, a fuzzy term such as vouchr~1 or
+// a wildcard pattern such as vouch*.
+// Stop words and punctuation produce no node.
+func (p *queryParser) wordNode(word string) Node {
+	if isWildcard(word) {
+		return wildcardNode(word, p.analysis.query)
+	}
+	if term, distance, ok := parseFuzzy(word); ok && len(analyzeWords(p.analysis.document, term)) == 1 {
+		terms := analyzeTerms(p.analysis.query, term)
+		if len(terms) == 0 {
+			return nil
+		}
+		return &FuzzyNode{Text: word, Term: terms[0], Distance: distance}
+	}
+
+	terms := uniqueStrings(analyzeTerms(p.analysis.query, word))
+	if len(terms) == 0 {
+		return nil // Stop words and punctuation
+	}
+	if words := analyzeWords(p.analysis.document, word); len(words) > 1 {
+		// The words of x-api-key must follow each other, as in the document
+		return p.synonymNode(&PhraseNode{Text: word, Words: words, Terms: terms, Compound: true}, word)
+	}
+	return p.synonymNode(&TermNode{Text: word, Terms: terms}, word)
+}
@@ -0,0 +1,340 @@
+package search_engine
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"api", "api"},
+		{"api authentication", "(api authentication)"},
+		{"api|auth", "(api OR auth)"},
+		{"api auth|login", "(api (auth OR login))"},
+		{"+voucher -transaction", "(+voucher -transaction)"},
+		{"voucher AND transaction", "(voucher AND transaction)"},
+		{"voucher OR transaction AND create", "(voucher OR (transaction AND create))"},
+		{"NOT delete voucher", "(voucher -delete)"},
+		{"(create OR update) AND voucher", "((create OR update) AND voucher)"},
+		{"+(create|update) voucher", "(+(create OR update) voucher)"},
+		{"x-api-key", "x-api-key"},
+		{"the and a", ""},
+		{`"Retrieve Many"`, `"retrieve many"`},
+		{`"voucher transaction"~3 api`, `("voucher transaction"~3 api)`},
+		{`-"by id" voucher`, `(voucher -"by id")`},
+		{`"unterminated phrase`, `"unterminated phrase"`},
+		{`""`, ""},
+		{"path:api pagination", "(+path:api pagination)"},
+		{`heading:"Retrieve Many" -ext:md`, `(+heading:"retrieve many" -ext:md)`},
+		{"api ext:yaml|ext:yml", "(+(ext:yaml OR ext:yml) api)"},
+		{"ext:yaml|api", "(ext:yaml OR api)"},
+		{"Name:Vouchers", "name:Vouchers"},
+		{"key:value", "key:value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			if got := q.String(); got != tt.expected {
+				t.Errorf("ParseQuery(%q) = %s, expected %s", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseQuery_SyntaxErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		problem string
+	}{
+		{"(api", "unbalanced ("},
+		{"api) OR", "unbalanced )"},
+		{"AND api", "AND without a left operand"},
+		{"api OR", "OR without an operand"},
+		{"(api AND)", "AND without an operand"},
+		{"api NOT", "NOT without an operand"},
+	}
+
+	engine := NewSearchEngine(fstest.MapFS{"api.md": &fstest.MapFile{Data: []byte("The api")}})
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := ParseQuery(tt.query)
+			var syntaxErr *QuerySyntaxError
+			if !errors.As(err, &syntaxErr) || syntaxErr.Problem != tt.problem {
+				t.Fatalf("ParseQuery(%q) error = %v, expected %q", tt.query, err, tt.problem)
+			}
+
+			// The engines work around the problem
+			results, err := engine.FindRelevantFiles(tt.query, 10)
+			if err != nil || len(results) != 1 {
+				t.Errorf("FindRelevantFiles(%q) = %v, %v, expected api.md", tt.query, results, err)
+			}
+		})
+	}
+}
+
+func TestQuery_Terms(t *testing.T) {
+	q, _ := ParseQuery("+vouchers (create|update) -deleted NOT removed")
+
+	expected := []string{"vouchers", "voucher", "create", "creat", "update", "updat"}
+	if got := q.Terms(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Terms() = %v, expected %v", got, expected)
+	}
+
+	expectedExcluded := []string{"deleted", "delet", "removed", "remov"}
+	if got := q.ExcludedTerms(); !reflect.DeepEqual(got, expectedExcluded) {
+		t.Errorf("ExcludedTerms() = %v, expected %v", got, expectedExcluded)
+	}
+}
+
+func TestFindRelevantFiles_BooleanQueries(t *testing.T) {
+	testFS := fstest.MapFS{
+		"vouchers.md":     &fstest.MapFile{Data: []byte("Voucher transaction endpoints")},
+		"payments.md":     &fstest.MapFile{Data: []byte("Payment transaction endpoints")},
+		"customers.md":    &fstest.MapFile{Data: []byte("Customer records, see payment")},
+		"authenticate.md": &fstest.MapFile{Data: []byte("Send the key header")},
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"transaction", []string{"payments.md", "vouchers.md"}},
+		{"transaction -voucher", []string{"payments.md"}},
+		{"transaction NOT voucher", []string{"payments.md"}},
+		{"+payment transaction", []string{"customers.md", "payments.md"}},
+		{"payment AND transaction", []string{"payments.md"}},
+		{"voucher|customer", []string{"customers.md", "vouchers.md"}},
+		{"(voucher OR customer) AND -records", []string{"vouchers.md"}},
+		{"+header +voucher", nil},
+	}
+
+	engines := map[string]SearchEngine{"scan": NewSearchEngine(testFS)}
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+	engines["indexed"] = indexed
+
+	for name, engine := range engines {
+		for _, tt := range tests {
+			results, err := engine.FindRelevantFiles(tt.query, 10)
+			if err != nil {
+				t.Fatalf("%s: FindRelevantFiles(%q) error = %v", name, tt.query, err)
+			}
+
+			var paths []string
+			for _, result := range results {
+				paths = append(paths, result.Path)
+			}
+			sort.Strings(paths)
+
+			if !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("%s: FindRelevantFiles(%q) = %v, expected %v", name, tt.query, paths, tt.expected)
+			}
+		}
+	}
+}
+
+func TestFindRelevantFiles_SignsMatchLikeOptionalWords(t *testing.T) {
+	testFS := fstest.MapFS{
+		"api_authentication.md": &fstest.MapFile{Data: []byte("Send the token header")},
+		"tokens.md":             &fstest.MapFile{Data: []byte("Renew the token")},
+	}
+	synonyms := NewSynonyms()
+	synonyms.AddGroup("authentication", "login")
+	opts := Options{Synonyms: synonyms}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		// login is a synonym of authentication, a word of the file name
+		{"login", []string{"api_authentication.md"}},
+		{"+login", []string{"api_authentication.md"}},
+		{"token -login", []string{"tokens.md"}},
+		{"+authent", []string{"api_authentication.md"}},
+		{"token -authent", []string{"tokens.md"}},
+	}
+
+	indexed, err := NewIndexedSearchEngineWithOptions(testFS, opts)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngineWithOptions() error = %v", err)
+	}
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngineWithOptions(testFS, opts), "index": indexed} {
+		for _, tt := range tests {
+			results, err := engine.FindRelevantFiles(tt.query, 10)
+			if err != nil {
+				t.Fatalf("%s: FindRelevantFiles(%q) error = %v", name, tt.query, err)
+			}
+			var paths []string
+			for _, result := range results {
+				paths = append(paths, result.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("%s: FindRelevantFiles(%q) = %v, expected %v", name, tt.query, paths, tt.expected)
+			}
+		}
+	}
+}
+
+func TestExtractRelevantContent_ExcludedTerms(t *testing.T) {
+	testFS := fstest.MapFS{
+		"vouchers.md": &fstest.MapFile{Data: []byte("Create a voucher\nfiller\nfiller\nfiller\nDelete a voucher")},
+	}
+
+	content, err := NewSearchEngine(testFS).ExtractRelevantContent("vouchers.md", "voucher -delete", 0)
+	if err != nil {
+		t.Fatalf("ExtractRelevantContent() error = %v", err)
+	}
+	if content != "Create a voucher" {
+		t.Errorf("Expected only the line without the excluded term, got %q", content)
+	}
+}
+
+func TestFindRelevantFiles_Phrases(t *testing.T) {
+	testFS := fstest.MapFS{
+		"exact.md":    &fstest.MapFile{Data: []byte("Use retrieve many to list vouchers")},
+		"split.md":    &fstest.MapFile{Data: []byte("Retrieve one voucher.\nThere are many options")},
+		"reversed.md": &fstest.MapFile{Data: []byte("Many calls retrieve data")},
+		"wrapped.md":  &fstest.MapFile{Data: []byte("You can retrieve\nmany items")},
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{`"retrieve many"`, []string{"exact.md", "wrapped.md"}},
+		{`"Retrieve, many!"`, []string{"exact.md", "wrapped.md"}},
+		{`"retrieve many"~1`, []string{"exact.md", "reversed.md", "wrapped.md"}},
+		{`"retrieve many"~5`, []string{"exact.md", "reversed.md", "split.md", "wrapped.md"}},
+		{`+"retrieve many" -"many items"`, []string{"exact.md"}},
+		{`"many to list"`, []string{"exact.md"}},
+	}
+
+	engines := map[string]SearchEngine{"scan": NewSearchEngine(testFS)}
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+	engines["indexed"] = indexed
+
+	for name, engine := range engines {
+		for _, tt := range tests {
+			results, err := engine.FindRelevantFiles(tt.query, 10)
+			if err != nil {
+				t.Fatalf("%s: FindRelevantFiles(%q) error = %v", name, tt.query, err)
+			}
+
+			var paths []string
+			for _, result := range results {
+				paths = append(paths, result.Path)
+			}
+			sort.Strings(paths)
+
+			if !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("%s: FindRelevantFiles(%q) = %v, expected %v", name, tt.query, paths, tt.expected)
+			}
+		}
+	}
+}
+
+func TestExtractRelevantContent_PrefersPhrase(t *testing.T) {
+	testFS := fstest.MapFS{
+		"vouchers.md": &fstest.MapFile{Data: []byte("# Retrieve a voucher by code, many fields\nfiller\nfiller\nfiller\nfiller\n## Retrieve many")},
+	}
+
+	content, err := NewSearchEngine(testFS).ExtractRelevantContent("vouchers.md", `"retrieve many"`, 0)
+	if err != nil {
+		t.Fatalf("ExtractRelevantContent() error = %v", err)
+	}
+	phrase, other := strings.Index(content, "## Retrieve many"), strings.Index(content, "# Retrieve a voucher")
+	if phrase < 0 || phrase > other {
+		t.Errorf("Expected the line with the phrase first, got %q", content)
+	}
+}
+
+func TestFindRelevantFiles_FieldOperators(t *testing.T) {
+	testFS := fstest.MapFS{
+		"api/vouchers.md":    &fstest.MapFile{Data: []byte("# Vouchers\n## Fields\nThe pagination fields.\n```\ncurl -X GET /vouchers\n```")},
+		"api/payments.yaml":  &fstest.MapFile{Data: []byte("pagination: true\nfields: [id]")},
+		"hooks/webhooks.yml": &fstest.MapFile{Data: []byte("events: [created]")},
+		"guides/paging.md":   &fstest.MapFile{Data: []byte("# Paging\nUse pagination with curl.\n| voucherProduct | id |")},
+		"guides/fields.md":   &fstest.MapFile{Data: []byte("# Fields\nEvery field is documented.")},
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"path:api pagination", []string{"api/payments.yaml", "api/vouchers.md"}},
+		{"path:guides", []string{"guides/fields.md", "guides/paging.md"}},
+		{"name:vouchers", []string{"api/vouchers.md"}},
+		{"ext:yaml", []string{"api/payments.yaml"}},
+		{"ext:yaml|ext:yml", []string{"api/payments.yaml", "hooks/webhooks.yml"}},
+		{"pagination ext:yaml|ext:yml", []string{"api/payments.yaml"}},
+		{"events ext:md|ext:yml", []string{"hooks/webhooks.yml"}},
+		{"ext:.md fields", []string{"api/vouchers.md", "guides/fields.md"}},
+		{"heading:fields", []string{"api/vouchers.md", "guides/fields.md"}},
+		{"code:curl", []string{"api/vouchers.md"}},
+		{"body:curl", []string{"guides/paging.md"}},
+		{"table:voucherProduct", []string{"guides/paging.md"}},
+		{`heading:"paging"`, []string{"guides/paging.md"}},
+		{"pagination -path:api", []string{"guides/paging.md"}},
+		{"unknown:value", nil},
+	}
+
+	engines := map[string]SearchEngine{"scan": NewSearchEngine(testFS)}
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+	engines["indexed"] = indexed
+
+	for name, engine := range engines {
+		for _, tt := range tests {
+			results, err := engine.FindRelevantFiles(tt.query, 10)
+			if err != nil {
+				t.Fatalf("%s: FindRelevantFiles(%q) error = %v", name, tt.query, err)
+			}
+
+			var paths []string
+			for _, result := range results {
+				paths = append(paths, result.Path)
+			}
+			sort.Strings(paths)
+
+			if !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("%s: FindRelevantFiles(%q) = %v, expected %v", name, tt.query, paths, tt.expected)
+			}
+		}
+	}
+}
+
+func TestScorers_FieldScopedTerms(t *testing.T) {
+	doc := newDocument("docs/guide.md", "# Guide\nRun curl to test.\n```\ncurl -X GET /api\n```")
+	stats := newCorpusStats([]*Document{doc})
+
+	for _, scorer := range []Scorer{HeuristicScorer{}, NewBM25Scorer()} {
+		all, _ := scorer.Score(doc, []QueryTerm{{Text: "curl"}}, stats)
+		code, _ := scorer.Score(doc, []QueryTerm{{Text: "curl", Fields: []Field{FieldCode}}}, stats)
+		table, _ := scorer.Score(doc, []QueryTerm{{Text: "curl", Fields: []Field{FieldTable}}}, stats)
+
+		if code <= 0 || code >= all {
+			t.Errorf("%T: code scoped score %f should be positive and below %f", scorer, code, all)
+		}
+		if table != 0 {
+			t.Errorf("%T: term absent from the table field should score zero, got %f", scorer, table)
+		}
+	}
+}
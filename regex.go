@@ -0,0 +1,302 @@
+package search_engine
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// RegexNode matches documents whose content matches a regular expression.
+// It is written /pattern/ in queries, optionally followed by the i flag for a
+// case-insensitive match and the s flag to let . match newlines. ^ and $ match
+// at line boundaries.
+type RegexNode struct {
+	Source string // The pattern as written between the slashes
+	Flags  string // Flags written after the closing slash
+	Regexp *regexp.Regexp
+}
+
+// regexFlags are the flags a pattern may be followed by, which are those of Go's
+// regexp syntax with the same meaning
+const regexFlags = "is"
+
+// newRegexNode compiles a pattern with its flags
+func newRegexNode(source, flags string) (*RegexNode, error) {
+	prefix := "(?m"
+	for _, flag := range flags {
+		if !strings.ContainsRune(regexFlags, flag) {
+			return nil, fmt.Errorf("invalid regular expression /%s/%s: unknown flag %c", source, flags, flag)
+		}
+		if !strings.ContainsRune(prefix, flag) {
+			prefix += string(flag)
+		}
+	}
+	re, err := regexp.Compile(prefix + ")" + source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression /%s/: %w", source, err)
+	}
+	return &RegexNode{Source: source, Flags: flags, Regexp: re}, nil
+}
+
+func (n *RegexNode) String() string { return "/" + n.Source + "/" + n.Flags }
+
+func (n *RegexNode) matches(doc *Document) bool { return n.Regexp.MatchString(doc.Content) }
+
+// collectTerms adds nothing, a regular expression filters but has no terms
+func (n *RegexNode) collectTerms(positive, negative *[]QueryTerm, negated bool) {}
+
+// RegexQuery returns a query that matches a regular expression, escaping the
+// slashes of the pattern that aren't escaped yet
+func RegexQuery(pattern string) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	escaped := false
+	for _, r := range pattern {
+		if r == '/' && !escaped {
+			b.WriteByte('\\')
+		}
+		escaped = r == '\\' && !escaped
+		b.WriteRune(r)
+	}
+	b.WriteByte('/')
+	return b.String()
+}
+
+// matchingLines returns the zero-based lines touched by every match, in order
+// and without duplicates
+func (n *RegexNode) matchingLines(content string) []int {
+	var lines []int
+	last := -1
+	for _, loc := range n.Regexp.FindAllStringIndex(content, -1) {
+		start := strings.Count(content[:loc[0]], "\n")
+		end := start + strings.Count(content[loc[0]:loc[1]], "\n")
+		for line := max(start, last+1); line <= end; line++ {
+			lines = append(lines, line)
+			last = line
+		}
+	}
+	return lines
+}
+
+// lexRegex reads a /pattern/flags token starting at the opening slash. It
+// returns false when the slash doesn't open a pattern, as in /api/v1, which is
+// then read as a word.
+func lexRegex(runes []rune, start int) (source, flags string, end int, ok bool) {
+	i := start + 1
+	for i < len(runes) && runes[i] != '/' {
+		if runes[i] == '\\' {
+			i++ // The escaped character, such as \/, is part of the pattern
+		}
+		i++
+	}
+	if i >= len(runes) || i == start+1 {
+		return "", "", 0, false
+	}
+	source = string(runes[start+1 : i])
+	i++
+
+	flagStart := i
+	for i < len(runes) && strings.ContainsRune(regexFlags, runes[i]) {
+		i++
+	}
+	flags = string(runes[flagStart:i])
+
+	if i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("()|", runes[i]) {
+		return "", "", 0, false
+	}
+	return source, flags, i, true
+}
+
+// regexNodes returns the regular expressions a document must match: those of
+// the root and of its required clauses
+func regexNodes(q *Query) []*RegexNode {
+	var nodes []*RegexNode
+	var required func(node Node)
+	required = func(node Node) {
+		switch n := node.(type) {
+		case *RegexNode:
+			nodes = append(nodes, n)
+		case *AndNode:
+			for _, child := range n.Children {
+				required(child)
+			}
+		case *BoolNode:
+			for _, child := range n.Must {
+				required(child)
+			}
+		}
+	}
+	required(q.Root)
+	return nodes
+}
+
+// Trigram prefiltering
+//
+// A regular expression can only match a document containing the literal text
+// the expression requires. That text is turned into a query over the trigrams
+// of the lowercased documents, evaluated on the index before running the
+// expression itself.
+
+// trigramQuery is a boolean query over trigrams. A nil query matches everything.
+type trigramQuery struct {
+	or       bool // Any child or trigram is enough, otherwise all are required
+	trigrams []string
+	children []*trigramQuery
+}
+
+// regexTrigrams returns the trigram query required by a regular expression,
+// nil when it can't narrow the documents down
+func regexTrigrams(re *regexp.Regexp) *trigramQuery {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	return trigramsOf(parsed.Simplify())
+}
+
+func trigramsOf(re *syntax.Regexp) *trigramQuery {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return literalTrigrams(string(re.Rune))
+	case syntax.OpCapture, syntax.OpPlus:
+		return trigramsOf(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return trigramsOf(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		// Adjacent literals form a longer literal, with more trigrams
+		q := &trigramQuery{}
+		var literal []rune
+		flush := func() {
+			q.add(literalTrigrams(string(literal)))
+			literal = nil
+		}
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral {
+				literal = append(literal, sub.Rune...)
+				continue
+			}
+			flush()
+			q.add(trigramsOf(sub))
+		}
+		flush()
+		return q.simplify()
+	case syntax.OpAlternate:
+		q := &trigramQuery{or: true}
+		for _, sub := range re.Sub {
+			child := trigramsOf(sub)
+			if child == nil {
+				return nil // This branch may match anything
+			}
+			q.children = append(q.children, child)
+		}
+		return q
+	}
+	return nil
+}
+
+// literalTrigrams requires every trigram of a literal
+func literalTrigrams(literal string) *trigramQuery {
+	lower := strings.ToLower(literal)
+	if len(lower) < 3 {
+		return nil
+	}
+	q := &trigramQuery{}
+	for i := 0; i+3 <= len(lower); i++ {
+		q.trigrams = append(q.trigrams, lower[i:i+3])
+	}
+	return q
+}
+
+// add requires a child query, nil requires nothing
+func (q *trigramQuery) add(child *trigramQuery) {
+	if child != nil {
+		q.children = append(q.children, child)
+	}
+}
+
+// simplify returns nil for an AND query without requirements
+func (q *trigramQuery) simplify() *trigramQuery {
+	if len(q.trigrams) == 0 && len(q.children) == 0 {
+		return nil
+	}
+	return q
+}
+
+// docs evaluates the query against a trigram index and returns the sorted
+// positions of the documents that may match
+func (q *trigramQuery) docs(trigrams map[string][]int, all []int) []int {
+	if q == nil {
+		return all
+	}
+
+	var sets [][]int
+	for _, trigram := range q.trigrams {
+		sets = append(sets, trigrams[trigram])
+	}
+	for _, child := range q.children {
+		sets = append(sets, child.docs(trigrams, all))
+	}
+
+	result := sets[0]
+	for _, set := range sets[1:] {
+		if q.or {
+			result = unionInts(result, set)
+		} else {
+			result = intersectInts(result, set)
+		}
+	}
+	return result
+}
+
+// buildTrigrams indexes the trigrams of the lowercased content of every document
+func buildTrigrams(docs []*Document) map[string][]int {
+	trigrams := make(map[string][]int)
+	for i, doc := range docs {
+		// Expressions match the content as written, not as analyzed
+		lower := strings.ToLower(doc.Content)
+		seen := make(map[string]bool)
+		for j := 0; j+3 <= len(lower); j++ {
+			trigram := lower[j : j+3]
+			if !seen[trigram] {
+				seen[trigram] = true
+				trigrams[trigram] = append(trigrams[trigram], i)
+			}
+		}
+	}
+	return trigrams
+}
+
+func intersectInts(a, b []int) []int {
+	var result []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+func unionInts(a, b []int) []int {
+	result := append(append([]int(nil), a...), b...)
+	sort.Ints(result)
+
+	var unique []int
+	for _, v := range result {
+		if len(unique) == 0 || unique[len(unique)-1] != v {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
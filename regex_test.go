@@ -0,0 +1,175 @@
+package search_engine
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseQuery_Regex(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{`/GET https:\/\/.*voucher/`, `/GET https:\/\/.*voucher/`},
+		{`/post|put/i voucher`, `(+/post|put/i voucher)`},
+		{`/begin.*end/is`, `/begin.*end/is`},
+		{`-/TODO/ api`, `(api -/TODO/)`},
+		{`/api/v1`, `/api/v1`},
+		{`/unterminated`, `/unterminated`},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", tt.query, err)
+		}
+		if got := q.String(); got != tt.expected {
+			t.Errorf("ParseQuery(%q) = %s, expected %s", tt.query, got, tt.expected)
+		}
+	}
+
+	if _, err := ParseQuery(`/voucher(/`); err == nil {
+		t.Errorf("Expected an error for an invalid regular expression")
+	}
+}
+
+func TestNewRegexNode_Flags(t *testing.T) {
+	tests := []struct {
+		flags   string
+		text    string
+		matches bool
+	}{
+		{"", "Begin\nend", false},
+		{"i", "begin\nEnd", false},
+		{"s", "begin\nend", true},
+		{"s", "Begin\nend", false},
+		{"is", "Begin\nEND", true},
+	}
+	for _, tt := range tests {
+		n, err := newRegexNode("begin.end", tt.flags)
+		if err != nil {
+			t.Fatalf("newRegexNode(%q) error = %v", tt.flags, err)
+		}
+		if got := n.Regexp.MatchString(tt.text); got != tt.matches {
+			t.Errorf("/begin.end/%s matches %q = %v, expected %v", tt.flags, tt.text, got, tt.matches)
+		}
+	}
+
+	if _, err := newRegexNode("begin", "g"); err == nil {
+		t.Errorf("Expected an error for an unknown flag")
+	}
+}
+
+func TestRegexQuery(t *testing.T) {
+	tests := map[string]string{
+		`GET https://.*`:   `/GET https:\/\/.*/`,
+		`GET https:\/\/.*`: `/GET https:\/\/.*/`,
+		`a\\/b`:            `/a\\\/b/`,
+	}
+	for pattern, expected := range tests {
+		if got := RegexQuery(pattern); got != expected {
+			t.Errorf("RegexQuery(%q) = %q, expected %q", pattern, got, expected)
+		}
+	}
+}
+
+func TestRegexTrigrams(t *testing.T) {
+	docs := []*Document{
+		newDocument("a.md", "GET https://host/api/voucher"),
+		newDocument("b.md", "POST https://host/api/payment"),
+		newDocument("c.md", "Nothing to see"),
+	}
+	trigrams := buildTrigrams(docs)
+	all := []int{0, 1, 2}
+
+	tests := []struct {
+		pattern  string
+		expected []int
+	}{
+		{`GET https://.*voucher`, []int{0}},
+		{`(?i)post|get`, []int{0, 1}},
+		{`api/(voucher|payment)`, []int{0, 1}},
+		{`v.*r`, []int{0, 1, 2}},
+		{`see\b`, []int{2}},
+		{`(?:host){2,}`, []int{0, 1}},
+	}
+
+	for _, tt := range tests {
+		node, err := newRegexNode(tt.pattern, "")
+		if err != nil {
+			t.Fatalf("newRegexNode(%q) error = %v", tt.pattern, err)
+		}
+		got := regexTrigrams(node.Regexp).docs(trigrams, all)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Trigram candidates of %q = %v, expected %v", tt.pattern, got, tt.expected)
+		}
+	}
+}
+
+func TestFindRelevantFiles_Regex(t *testing.T) {
+	engines := map[string]SearchEngine{"scan": NewSearchEngine(os.DirFS("testData"))}
+	indexed, err := NewIndexedSearchEngine(os.DirFS("testData"))
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+	engines["indexed"] = indexed
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{`/GET https:\/\/.*voucherTransaction/`, []string{"vouchers.md"}},
+		{`/^pagination and/i`, []string{"api_paginationAndFiltering.md"}},
+		{`/voucherTransaction/ -/voucherPrice/`, nil},
+		{`/no such text anywhere/`, nil},
+	}
+
+	for name, engine := range engines {
+		for _, tt := range tests {
+			results, err := engine.FindRelevantFiles(tt.query, 10)
+			if err != nil {
+				t.Fatalf("%s: FindRelevantFiles(%q) error = %v", name, tt.query, err)
+			}
+
+			var paths []string
+			for _, result := range results {
+				paths = append(paths, result.Path)
+			}
+			sort.Strings(paths)
+
+			if !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("%s: FindRelevantFiles(%q) = %v, expected %v", name, tt.query, paths, tt.expected)
+			}
+		}
+	}
+
+	if _, err := engines["indexed"].FindRelevantFiles(`/(/`, 10); err == nil {
+		t.Errorf("Expected an error for an invalid regular expression")
+	}
+}
+
+func TestExtractRelevantContent_Regex(t *testing.T) {
+	testFS := fstest.MapFS{
+		"api.md": &fstest.MapFile{Data: []byte("# API\nGET /vouchers\nSome text\nPOST /vouchers\nDELETE /vouchers/1")},
+	}
+
+	content, err := NewSearchEngine(testFS).ExtractRelevantContent("api.md", `/^(GET|POST) /`, 3)
+	if err != nil {
+		t.Fatalf("ExtractRelevantContent() error = %v", err)
+	}
+
+	expected := "2: GET /vouchers\n4: POST /vouchers"
+	if content != expected {
+		t.Errorf("ExtractRelevantContent() = %q, expected %q", content, expected)
+	}
+
+	// A match spanning lines returns all of them
+	content, _ = NewSearchEngine(testFS).ExtractRelevantContent("api.md", `/text\nPOST/`, 0)
+	if !strings.HasPrefix(content, "3: Some text\n4: POST") {
+		t.Errorf("Expected both lines of a multi-line match, got %q", content)
+	}
+}
@@ -0,0 +1,339 @@
+package search_engine
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Scorer computes how relevant a document is to a query
+type Scorer interface {
+	// Score returns the relevance of doc to the normalized query terms and a
+	// human-readable reason. A score of zero means the document doesn't match.
+	// Terms restricted to some fields must only be scored in those fields.
+	Score(doc *Document, queryTerms []QueryTerm, stats *CorpusStats) (float64, string)
+}
+
+// CorpusStats holds collection-wide statistics needed by scorers such as BM25
+type CorpusStats struct {
+	Documents      int // Number of documents in the collection
+	avgFieldLength [fieldCount]float64
+	docFreq        map[string]int
+	dictionary     []string // Sorted terms of every field
+	words          []string // Sorted terms occurring as words rather than only as stems
+	language       Language // Language most documents are written in, "" when none is
+}
+
+// newCorpusStats computes the statistics of a collection of documents
+func newCorpusStats(docs []*Document) *CorpusStats {
+	stats := &CorpusStats{
+		Documents: len(docs),
+		docFreq:   make(map[string]int),
+	}
+
+	var totals [fieldCount]int
+	words := make(map[string]bool)
+	languages := make(map[Language]int)
+	for _, doc := range docs {
+		if doc.Language != "" {
+			languages[doc.Language]++
+		}
+		for word := range doc.words {
+			words[word] = true
+		}
+		seen := make(map[string]bool)
+		for f := range doc.fields {
+			totals[f] += doc.fields[f].length
+			for term := range doc.fields[f].freq {
+				if !seen[term] {
+					seen[term] = true
+					stats.docFreq[term]++
+				}
+			}
+		}
+	}
+
+	for term := range stats.docFreq {
+		stats.dictionary = append(stats.dictionary, term)
+	}
+	sort.Strings(stats.dictionary)
+	for _, term := range stats.dictionary {
+		if words[term] {
+			stats.words = append(stats.words, term)
+		}
+	}
+
+	if len(docs) > 0 {
+		for f := range totals {
+			stats.avgFieldLength[f] = float64(totals[f]) / float64(len(docs))
+		}
+	}
+
+	stats.language = dominantLanguage(languages)
+
+	return stats
+}
+
+// dominantLanguage returns the language with more documents than any other,
+// "" when there is none
+func dominantLanguage(counts map[Language]int) Language {
+	var best Language
+	bestCount, tied := 0, false
+	for lang, count := range counts {
+		switch {
+		case count > bestCount:
+			best, bestCount, tied = lang, count, false
+		case count == bestCount:
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return best
+}
+
+// DocumentFrequency returns the number of documents containing a lowercased term in any field
+func (s *CorpusStats) DocumentFrequency(term string) int {
+	return s.docFreq[term]
+}
+
+// AverageFieldLength returns the average number of tokens of a field across documents
+func (s *CorpusStats) AverageFieldLength(field Field) float64 {
+	return s.avgFieldLength[field]
+}
+
+// searchDocuments expands the query against the words of the collection,
+// up to maxExpansions terms each, and scores the candidate documents for its terms. When no document
+// matches, such as when a required term is misspelled, the search is repeated with every term made fuzzy.
+// It returns the matches and the query they were found with.
+func searchDocuments(q *Query, candidates func(q *Query) []*Document, scorer Scorer, stats *CorpusStats, maxExpansions int) ([]FileMatch, *Query) {
+	expandQuery(q, stats.words, maxExpansions)
+	matches := scoreDocuments(candidates(q), q, scorer, stats)
+	if len(matches) > 0 {
+		return matches, q
+	}
+
+	fuzzy := fuzzyQuery(q)
+	if fuzzy == nil {
+		return matches, q
+	}
+	expandQuery(fuzzy, stats.words, maxExpansions)
+	if fuzzyMatches := scoreDocuments(candidates(fuzzy), fuzzy, scorer, stats); len(fuzzyMatches) > 0 {
+		return fuzzyMatches, fuzzy
+	}
+	return matches, q
+}
+
+// scoreDocuments scores every document satisfying the query and returns the
+// ones that match, in input order
+func scoreDocuments(docs []*Document, q *Query, scorer Scorer, stats *CorpusStats) []FileMatch {
+	var matches []FileMatch
+	for _, doc := range docs {
+		if score, reason := scoreDocument(doc, q, scorer, stats); score > 0 {
+			matches = append(matches, FileMatch{
+				Path:     doc.Path,
+				Score:    score,
+				Reason:   reason,
+				FileName: filepath.Base(doc.Path),
+				Language: doc.Language,
+			})
+		}
+	}
+	return matches
+}
+
+// scoreDocument scores a document for the query, zero when it doesn't satisfy
+// it. When the query only has filters, such as ext:md, every document passing
+// them gets the same score.
+func scoreDocument(doc *Document, q *Query, scorer Scorer, stats *CorpusStats) (float64, string) {
+	return scoreDocumentTerms(doc, q, q.ScoringTerms(), scorer, stats)
+}
+
+// scoreDocumentTerms scores a document that must satisfy the query for some of
+// the scoring terms of the query
+func scoreDocumentTerms(doc *Document, q *Query, queryTerms []QueryTerm, scorer Scorer, stats *CorpusStats) (float64, string) {
+	if !q.Matches(doc) {
+		return 0, ""
+	}
+
+	var score float64
+	var reason string
+	switch {
+	case len(queryTerms) > 0:
+		score, reason = scorer.Score(doc, queryTerms, stats)
+	case hasFilter(q.Root):
+		score, reason = filterScore(doc, q)
+	}
+	if score <= 0 {
+		return 0, ""
+	}
+
+	if expanded := expansionReason(doc, queryTerms); expanded != "" {
+		reason = strings.TrimPrefix(reason+", "+expanded, ", ")
+	}
+	for _, term := range truncatedExpansions(q) {
+		reason += ", " + term
+	}
+	return score, reason
+}
+
+// filterScore scores a document for a query made only of filters. Documents
+// with more lines matching the regular expressions of the query rank higher.
+func filterScore(doc *Document, q *Query) (float64, string) {
+	regexes := regexNodes(q)
+	if len(regexes) == 0 {
+		return 1, "matches " + q.String()
+	}
+
+	var reasons []string
+	lines := 0
+	for _, re := range regexes {
+		n := len(re.matchingLines(doc.Content))
+		lines += n
+		reason := fmt.Sprintf("regex %s matches %d line", re, n)
+		if n != 1 {
+			reason += "s"
+		}
+		reasons = append(reasons, reason)
+	}
+	return float64(lines) / float64(lines+1), strings.Join(reasons, ", ")
+}
+
+// expansionReason describes the generated terms found in a document, such as
+// fuzzy match 'vouchr'→'voucher' or wildcard match 'vouch*'→'voucher'/'vouchers'
+func expansionReason(doc *Document, queryTerms []QueryTerm) string {
+	var reasons []string
+	found := make(map[string][]string) // Matched terms by reason prefix
+	for _, term := range queryTerms {
+		if term.Expansion == "" {
+			continue
+		}
+		for f := 0; f < fieldCount; f++ {
+			if term.InField(Field(f)) && doc.TermFrequency(Field(f), term.Text) > 0 {
+				prefix := fmt.Sprintf("%s match '%s'→", term.Expansion, term.Original)
+				if found[prefix] == nil {
+					reasons = append(reasons, prefix)
+				}
+				found[prefix] = append(found[prefix], "'"+term.Text+"'")
+				break
+			}
+		}
+	}
+
+	for i, prefix := range reasons {
+		reasons[i] = prefix + strings.Join(found[prefix], "/")
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// ScorerByName returns the scorer selected by name: "heuristic" or "bm25"
+func ScorerByName(name string) (Scorer, error) {
+	switch strings.ToLower(name) {
+	case "", "heuristic":
+		return &HeuristicScorer{}, nil
+	case "bm25":
+		return NewBM25Scorer(), nil
+	default:
+		return nil, fmt.Errorf("unknown scorer %q", name)
+	}
+}
+
+// HeuristicScorer is the original ranking model: hand-tuned weights for
+// directory and filename matches plus a lower weighted content score
+type HeuristicScorer struct {
+	// Boosts weights content matches by the field they occur in. Path and
+	// filename matches have their own fixed weights. Defaults to DefaultFieldBoosts.
+	Boosts FieldBoosts
+}
+
+// Score implements Scorer
+func (h HeuristicScorer) Score(doc *Document, queryTerms []QueryTerm, stats *CorpusStats) (float64, string) {
+	if len(queryTerms) == 0 {
+		return 0, ""
+	}
+
+	boosts := h.Boosts
+	if boosts == nil {
+		boosts = defaultFieldBoosts
+	}
+
+	score, reasons := scorePath(doc, queryTerms)
+	contentScore, contentReason := scoreContent(doc, queryTerms, boosts)
+	return combineScores(score, reasons, contentScore, contentReason)
+}
+
+// defaultFieldBoosts is shared by scorers without custom boosts, it must not be modified
+var defaultFieldBoosts = DefaultFieldBoosts()
+
+// BM25Scorer ranks documents with BM25F: BM25 over a weighted combination of
+// the document fields, each normalized by its own average length
+type BM25Scorer struct {
+	K1     float64     // Term frequency saturation
+	B      float64     // Length normalization, from 0 (none) to 1 (full)
+	Boosts FieldBoosts // Weight of each field, fields not listed are ignored
+}
+
+// NewBM25Scorer creates a BM25 scorer with the usual defaults
+func NewBM25Scorer() *BM25Scorer {
+	return &BM25Scorer{
+		K1:     1.2,
+		B:      0.75,
+		Boosts: DefaultFieldBoosts(),
+	}
+}
+
+// Score implements Scorer. The BM25 value is mapped into the 0-1 range with
+// s/(1+s), which keeps the order of scores without saturating.
+func (s *BM25Scorer) Score(doc *Document, queryTerms []QueryTerm, stats *CorpusStats) (float64, string) {
+	if stats == nil || stats.Documents == 0 {
+		stats = newCorpusStats([]*Document{doc})
+	}
+
+	total := 0.0
+	var reasons []string
+
+	for _, queryTerm := range queryTerms {
+		term := strings.ToLower(queryTerm.Text)
+
+		weighted := 0.0
+		var fields []string
+		for f := 0; f < fieldCount; f++ {
+			field := Field(f)
+			if !queryTerm.InField(field) {
+				continue
+			}
+			boost := s.Boosts[field]
+			tf := doc.TermFrequency(field, term)
+			if tf == 0 || boost <= 0 {
+				continue
+			}
+
+			norm := 1.0
+			if avg := stats.AverageFieldLength(field); avg > 0 {
+				norm = 1 - s.B + s.B*float64(doc.FieldLength(field))/avg
+			}
+			weighted += boost * float64(tf) / norm
+			fields = append(fields, field.String())
+		}
+
+		if weighted == 0 {
+			continue
+		}
+
+		n := float64(stats.Documents)
+		df := float64(stats.DocumentFrequency(term))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		total += queryTerm.weight() * idf * weighted / (s.K1 + weighted)
+		reasons = append(reasons, fmt.Sprintf("'%s' in %s", term, strings.Join(fields, ", ")))
+	}
+
+	if total == 0 {
+		return 0, ""
+	}
+
+	return total / (1 + total), "bm25: " + strings.Join(reasons, "; ")
+}
@@ -0,0 +1,111 @@
+package search_engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestBM25Scorer_Ranking(t *testing.T) {
+	long := "# Payments\n" + strings.Repeat("Misc notes about billing, refunds and retries.\n", 40) +
+		strings.Repeat("webhook ", 6)
+	testFS := fstest.MapFS{
+		"docs/webhooks.md":   &fstest.MapFile{Data: []byte("# Webhooks\nRegister a webhook URL.")},
+		"docs/payments.md":   &fstest.MapFile{Data: []byte(long)},
+		"docs/events.md":     &fstest.MapFile{Data: []byte("# Events\nA webhook is sent for each event.")},
+		"docs/unrelated.md":  &fstest.MapFile{Data: []byte("# Setup\nInstall the client.")},
+		"guides/webhook.md":  &fstest.MapFile{Data: []byte("Short guide.")},
+		"guides/overview.md": &fstest.MapFile{Data: []byte("Overview of the API.")},
+	}
+
+	finder := NewFileFinderWithOptions(testFS, Options{Scorer: NewBM25Scorer()})
+	results, err := finder.FindRelevantFiles("webhook", 10)
+	if err != nil {
+		t.Fatalf("FindRelevantFiles() error = %v", err)
+	}
+
+	rank := make(map[string]int)
+	for i, result := range results {
+		rank[result.Path] = i
+		if result.Score <= 0 || result.Score >= 1 {
+			t.Errorf("Score of %s = %f, expected within (0, 1)", result.Path, result.Score)
+		}
+		if i > 0 && result.Score == results[i-1].Score {
+			t.Errorf("Unexpected tie between %s and %s", result.Path, results[i-1].Path)
+		}
+	}
+
+	if _, ok := rank["docs/unrelated.md"]; ok {
+		t.Errorf("Unrelated file should not match")
+	}
+	if rank["docs/events.md"] > rank["docs/payments.md"] {
+		t.Errorf("Concise page should outrank a long page with many repeats: %v", results)
+	}
+	if rank["guides/webhook.md"] > rank["docs/events.md"] {
+		t.Errorf("Filename match should outrank a single body match: %v", results)
+	}
+
+	// The index backed engine must rank exactly like the scan
+	indexed, err := NewIndexedSearchEngineWithOptions(testFS, Options{Scorer: NewBM25Scorer()})
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngineWithOptions() error = %v", err)
+	}
+	indexedResults, _ := indexed.FindRelevantFiles("webhook", 10)
+	if !reflect.DeepEqual(indexedResults, results) {
+		t.Errorf("Indexed BM25 results = %v, expected %v", indexedResults, results)
+	}
+}
+
+func TestBM25Scorer_FieldBoosts(t *testing.T) {
+	doc := newDocument("docs/guide.md", "# Tokens\nHow tokens work")
+	stats := newCorpusStats([]*Document{doc})
+
+	scorer := NewBM25Scorer()
+	withHeading, _ := scorer.Score(doc, []QueryTerm{{Text: "tokens"}}, stats)
+
+	scorer.Boosts[FieldTitle] = 0
+	withoutHeading, reason := scorer.Score(doc, []QueryTerm{{Text: "tokens"}}, stats)
+
+	if withoutHeading >= withHeading {
+		t.Errorf("Disabling the heading boost should lower the score: %f >= %f", withoutHeading, withHeading)
+	}
+	if reason != "bm25: 'tokens' in body" {
+		t.Errorf("Unexpected reason %q", reason)
+	}
+}
+
+func TestScorerByName(t *testing.T) {
+	if s, err := ScorerByName("BM25"); err != nil {
+		t.Errorf("ScorerByName(BM25) error = %v", err)
+	} else if _, ok := s.(*BM25Scorer); !ok {
+		t.Errorf("ScorerByName(BM25) = %T", s)
+	}
+
+	if s, _ := ScorerByName(""); reflect.TypeOf(s) != reflect.TypeOf(&HeuristicScorer{}) {
+		t.Errorf("Default scorer should be the heuristic, got %T", s)
+	}
+
+	if _, err := ScorerByName("tfidf"); err == nil {
+		t.Errorf("Expected an error for an unknown scorer")
+	}
+}
+
+func TestScorers_HeadingOutranksCode(t *testing.T) {
+	testFS := fstest.MapFS{
+		"docs/guide.md": &fstest.MapFile{Data: []byte("# Guide\n## Authentication\nSend the key header.")},
+		"docs/example.md": &fstest.MapFile{Data: []byte("# Example\n```json\n" +
+			`{"authentication": "key", "user": "demo"}` + "\n```")},
+	}
+
+	for _, scorer := range []Scorer{HeuristicScorer{}, NewBM25Scorer()} {
+		finder := NewFileFinderWithOptions(testFS, Options{Scorer: scorer})
+		results, err := finder.FindRelevantFiles("authentication", 10)
+		if err != nil {
+			t.Fatalf("FindRelevantFiles() error = %v", err)
+		}
+		if len(results) != 2 || results[0].Path != "docs/guide.md" {
+			t.Errorf("%T: expected the heading match first, got %v", scorer, results)
+		}
+	}
+}
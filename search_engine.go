@@ -2,6 +2,7 @@ package search_engine
 
 import (
 	"io/fs"
+	"strings"
 )
 
 // SearchEngine provides intelligent search capabilities for documentation files
@@ -12,25 +13,162 @@ type SearchEngine interface {
 	// ExtractRelevantContent extracts relevant content from a specific file for the query
 	ExtractRelevantContent(filePath, query string, contextLines int) (string, error)
 	
+	// ExtractContentMatches extracts the parts of a specific file relevant to
+	// the query, best first, with their line ranges and the terms they match
+	ExtractContentMatches(filePath, query string, contextLines int) ([]ContentMatch, error)
+	
 	// GetFileContent reads the complete content of a file
 	GetFileContent(filePath string) (string, error)
+	
+	// SearchSections finds the heading-delimited sections, across all files,
+	// that are most relevant to the query
+	SearchSections(query string, maxSections int) ([]SectionMatch, error)
+	
+	// BuildContext fills a token budget with the sections, across all files,
+	// that are most relevant to the query
+	BuildContext(query string, maxTokens int) (*PackedContext, error)
 }
 
 // FileMatch represents a file that matches a search query
 type FileMatch struct {
-	Path     string  `json:"path"`     // Relative path to the file
-	Score    float64 `json:"score"`    // Relevance score (0.0 to 1.0)
-	Reason   string  `json:"reason"`   // Human-readable explanation of why this file matches
-	FileName string  `json:"filename"` // Just the filename for quick reference
+	Path     string   `json:"path"`               // Relative path to the file
+	Score    float64  `json:"score"`              // Relevance score (0.0 to 1.0)
+	Reason   string   `json:"reason"`             // Human-readable explanation of why this file matches
+	FileName string   `json:"filename"`           // Just the filename for quick reference
+	Language Language `json:"language,omitempty"` // Language the file is written in, "" when unknown
+}
+
+// SectionMatch represents a section of a file that matches a search query: a
+// heading and the text under it up to its first subsection
+type SectionMatch struct {
+	Path       string   `json:"path"`               // Relative path to the file
+	Breadcrumb []string `json:"breadcrumb"`         // Headings leading to the section, outermost first
+	LineStart  int      `json:"line_start"`         // Line of the heading, 1-based
+	LineEnd    int      `json:"line_end"`           // Last line before the first subsection, 1-based
+	Score      float64  `json:"score"`              // Relevance score (0.0 to 1.0)
+	Reason     string   `json:"reason"`             // Human-readable explanation of why this section matches
+	Language   Language `json:"language,omitempty"` // Language the file is written in, "" when unknown
+}
+
+// Location returns the path and headings of the section, such as
+// "vouchers.md › Transaction › Endpoints"
+func (m SectionMatch) Location() string {
+	return strings.Join(append([]string{m.Path}, m.Breadcrumb...), breadcrumbSeparator)
 }
 
 // ContentMatch represents relevant content within a file
 type ContentMatch struct {
-	Content    string `json:"content"`     // The relevant content extracted
-	LineStart  int    `json:"line_start"`  // Starting line number
-	LineEnd    int    `json:"line_end"`    // Ending line number
-	Context    string `json:"context"`     // Additional context around the match
-	Confidence float64 `json:"confidence"` // How confident we are this content is relevant
+	Content    string      `json:"content"`    // The relevant content extracted
+	LineStart  int         `json:"line_start"` // Starting line number, 1-based
+	LineEnd    int         `json:"line_end"`   // Ending line number, 1-based and inclusive
+	Context    string      `json:"context"`    // Headings the match is under, such as "Transaction › Endpoints"
+	Confidence float64     `json:"confidence"` // How confident we are this content is relevant (0.0 to 1.0)
+	Terms      []string    `json:"terms"`      // Query terms found in the content
+	Highlights []Highlight `json:"highlights"` // Spans of the content matching the query, in order
+
+	numbered  bool   // Whether the content is a line selected by a regular expression
+	codeLines []bool // Whether each line of the content is in a code block
+}
+
+// Options configures a search engine. The zero value gives the default behavior.
+type Options struct {
+	// Scorer ranks documents against queries. Defaults to HeuristicScorer.
+	Scorer Scorer
+
+	// MaxExpansions limits the dictionary terms each wildcard or fuzzy term
+	// expands to. Defaults to DefaultMaxExpansions.
+	MaxExpansions int
+
+	// Analyzer turns documents into terms. Defaults to DefaultAnalyzer.
+	Analyzer Analyzer
+
+	// QueryAnalyzer turns the words of queries into the terms searched for.
+	// Defaults to DefaultQueryAnalyzer.
+	QueryAnalyzer Analyzer
+
+	// Languages are the languages whose stop words and stemmers the default
+	// analyzers apply. Documents and queries are analyzed in the one of them
+	// they declare (lang: es in front matter) or are detected to be written in,
+	// and in all of them when it can't be told. Defaults to DefaultLanguages.
+	Languages []Language
+
+	// FoldAccents makes the default analyzers fold accents in documents and
+	// queries, so that codigo matches código
+	FoldAccents bool
+
+	// StopWords are the words dropped from queries, outside of quoted phrases.
+	// Defaults to the stop words of the language of the query, or of all the
+	// languages when it can't be told. An empty set keeps every word.
+	StopWords StopWords
+
+	// Synonyms expands the words and phrases of queries to their synonyms,
+	// which weigh less than the words themselves. Defaults to none.
+	Synonyms *Synonyms
+
+	// TokenCounter counts the tokens of the sections BuildContext packs.
+	// Defaults to HeuristicTokenCounter.
+	TokenCounter TokenCounter
+
+	// Highlight is how ExtractRelevantContent marks the words matching the
+	// query. Defaults to HighlightNone.
+	Highlight HighlightStyle
+}
+
+// scorer returns the configured scorer or the default one
+func (o Options) scorer() Scorer {
+	if o.Scorer == nil {
+		return HeuristicScorer{}
+	}
+	return o.Scorer
+}
+
+// tokenCounter returns the configured token counter or the default one
+func (o Options) tokenCounter() TokenCounter {
+	if o.TokenCounter == nil {
+		return HeuristicTokenCounter{}
+	}
+	return o.TokenCounter
+}
+
+// maxExpansions returns the configured expansion limit or the default one
+func (o Options) maxExpansions() int {
+	if o.MaxExpansions <= 0 {
+		return DefaultMaxExpansions
+	}
+	return o.MaxExpansions
+}
+
+// languages returns the configured languages or the default ones
+func (o Options) languages() []Language {
+	if len(o.Languages) == 0 {
+		return DefaultLanguages
+	}
+	return o.Languages
+}
+
+// analyzers returns the configured analyzers or the default ones
+func (o Options) analyzers() analyzers {
+	languages := o.languages()
+	settings := analysisSettings{languages: languages, foldAccents: o.FoldAccents, stopWords: o.StopWords}
+	a := analyzers{
+		document:          settings.documentAnalyzer(),
+		query:             settings.queryAnalyzer(),
+		languages:         languages,
+		documentLanguages: settings.byLanguage(analysisSettings.documentAnalyzer),
+		queryLanguages:    settings.byLanguage(analysisSettings.queryAnalyzer),
+		fallbackQueries:   settings.withStopWordsOf(analysisSettings.queryAnalyzer),
+		synonyms:          o.Synonyms,
+	}
+	if o.Analyzer != nil {
+		a.document = o.Analyzer
+		a.documentLanguages = nil
+	}
+	if o.QueryAnalyzer != nil {
+		a.query = o.QueryAnalyzer
+		a.queryLanguages = nil
+		a.fallbackQueries = nil
+	}
+	return a
 }
 
 // SearchEngineImpl implements the SearchEngine interface
@@ -38,14 +176,21 @@ type SearchEngineImpl struct {
 	fs           fs.FS
 	fileFinder   *FileFinder
 	extractor    *ContentExtractor
+	tokens       TokenCounter
 }
 
 // NewSearchEngine creates a new SearchEngine instance
 func NewSearchEngine(filesystem fs.FS) SearchEngine {
+	return NewSearchEngineWithOptions(filesystem, Options{})
+}
+
+// NewSearchEngineWithOptions creates a new SearchEngine instance with custom options
+func NewSearchEngineWithOptions(filesystem fs.FS, opts Options) SearchEngine {
 	return &SearchEngineImpl{
 		fs:           filesystem,
-		fileFinder:   NewFileFinder(filesystem),
-		extractor:    NewContentExtractor(filesystem),
+		fileFinder:   NewFileFinderWithOptions(filesystem, opts),
+		extractor:    NewContentExtractorWithOptions(filesystem, opts),
+		tokens:       opts.tokenCounter(),
 	}
 }
 
@@ -54,11 +199,26 @@ func (se *SearchEngineImpl) FindRelevantFiles(query string, maxFiles int) ([]Fil
 	return se.fileFinder.FindRelevantFiles(query, maxFiles)
 }
 
+// SearchSections implements SearchEngine.SearchSections
+func (se *SearchEngineImpl) SearchSections(query string, maxSections int) ([]SectionMatch, error) {
+	return se.fileFinder.SearchSections(query, maxSections)
+}
+
+// BuildContext implements SearchEngine.BuildContext
+func (se *SearchEngineImpl) BuildContext(query string, maxTokens int) (*PackedContext, error) {
+	return buildContext(se, query, maxTokens, se.tokens)
+}
+
 // ExtractRelevantContent implements SearchEngine.ExtractRelevantContent
 func (se *SearchEngineImpl) ExtractRelevantContent(filePath, query string, contextLines int) (string, error) {
 	return se.extractor.ExtractRelevantContent(filePath, query, contextLines)
 }
 
+// ExtractContentMatches implements SearchEngine.ExtractContentMatches
+func (se *SearchEngineImpl) ExtractContentMatches(filePath, query string, contextLines int) ([]ContentMatch, error) {
+	return se.extractor.ExtractContentMatches(filePath, query, contextLines)
+}
+
 // GetFileContent implements SearchEngine.GetFileContent
 func (se *SearchEngineImpl) GetFileContent(filePath string) (string, error) {
 	content, err := fs.ReadFile(se.fs, filePath)
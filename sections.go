@@ -0,0 +1,120 @@
+package search_engine
+
+import (
+	"sort"
+	"strings"
+)
+
+// sectionDocument is a document made of the text of a single section of a
+// file, for ranking sections against each other
+type sectionDocument struct {
+	*Document
+	section *Section
+	endLine int // Last line of the section before its first subsection, zero-based
+}
+
+// sectionDocuments splits a document into a document for each of its sections.
+// A section holds its heading and its text up to its first subsection. The
+// headings of the sections enclosing it come first as a line of body text, so
+// that "transaction endpoints" finds the Endpoints section of Transaction
+// while a match in the own heading of a section counts more. The text before
+// the first heading is a section when it isn't blank.
+func sectionDocuments(doc *Document, analyzer Analyzer) []sectionDocument {
+	lines := strings.Split(doc.Content, "\n")
+
+	var docs []sectionDocument
+	for _, s := range doc.Outline().All() {
+		end := s.EndLine
+		if len(s.Children) > 0 {
+			end = max(s.Children[0].StartLine-1, s.StartLine)
+			if s.Level == 0 {
+				end = s.Children[0].StartLine - 1
+			}
+		}
+		own := strings.Join(lines[s.StartLine:end+1], "\n")
+		if s.Level == 0 && strings.TrimSpace(own) == "" {
+			continue
+		}
+
+		text := own
+		if s.Parent != nil && s.Parent.Level > 0 {
+			text = sectionBreadcrumb(s.Parent) + "\n" + own
+		}
+
+		sectionDoc := analyzeDocument(doc.Path, text, analyzer)
+		sectionDoc.Language = doc.Language
+		docs = append(docs, sectionDocument{Document: sectionDoc, section: s, endLine: end})
+	}
+	return docs
+}
+
+// contentQueryTerms restricts the query terms to the content fields. Every
+// section of a file shares its path and name, which can't tell them apart.
+// Terms only searched for in the path or name, as in path:api, are dropped.
+func contentQueryTerms(queryTerms []QueryTerm) []QueryTerm {
+	var restricted []QueryTerm
+	for _, term := range queryTerms {
+		var fields []Field
+		for _, field := range contentFields {
+			if term.InField(field) {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) > 0 {
+			term.Fields = fields
+			restricted = append(restricted, term)
+		}
+	}
+	return restricted
+}
+
+// scoreSections scores the sections of the documents for the query, with
+// statistics of those sections alone. The query must already be expanded.
+func scoreSections(q *Query, docs []*Document, scorer Scorer, analysis analyzers) []SectionMatch {
+	var sections []sectionDocument
+	for _, doc := range docs {
+		sections = append(sections, sectionDocuments(doc, analysis.forLanguage(doc.Language))...)
+	}
+
+	sectionDocs := make([]*Document, len(sections))
+	for i, s := range sections {
+		sectionDocs[i] = s.Document
+	}
+	stats := newCorpusStats(sectionDocs)
+
+	queryTerms := contentQueryTerms(q.ScoringTerms())
+	var matches []SectionMatch
+	for _, s := range sections {
+		score, reason := scoreDocumentTerms(s.Document, q, queryTerms, scorer, stats)
+		if score <= 0 {
+			continue
+		}
+		matches = append(matches, SectionMatch{
+			Path:       s.Path,
+			Breadcrumb: sectionHeadings(s.section),
+			LineStart:  s.section.StartLine + 1,
+			LineEnd:    s.endLine + 1,
+			Score:      score,
+			Reason:     reason,
+			Language:   s.Language,
+		})
+	}
+	return matches
+}
+
+// rankSectionMatches sorts matches by score (highest first) and limits the
+// results. Ties keep the order of the files and of the sections in them.
+func rankSectionMatches(matches []SectionMatch, maxSections int) []SectionMatch {
+	if maxSections <= 0 {
+		return []SectionMatch{}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	if len(matches) > maxSections {
+		matches = matches[:maxSections]
+	}
+	return matches
+}
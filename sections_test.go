@@ -0,0 +1,111 @@
+package search_engine
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSearchSections(t *testing.T) {
+	testFS := fstest.MapFS{
+		"guide.md": &fstest.MapFile{Data: []byte("# Guide\n" + // 1
+			"Read this first.\n" + // 2
+			"## Install\n" + // 3
+			"Run the installer.\n" + // 4
+			"## Webhooks\n" + // 5
+			"Events are posted to your server.\n" + // 6
+			"### Retries\n" + // 7
+			"Failed deliveries are retried\n" + // 8
+			"three times.\n" + // 9
+			"### Signatures\n" + // 10
+			"Check the signature header.")}, // 11
+		"faq.md": &fstest.MapFile{Data: []byte("# FAQ\n\nHow many retries? See the guide.")},
+	}
+
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+
+	var found [][]SectionMatch
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngine(testFS), "index": indexed} {
+		results, err := engine.SearchSections("webhook retries", 10)
+		if err != nil {
+			t.Fatalf("SearchSections() error = %v", err)
+		}
+		if len(results) == 0 {
+			t.Fatalf("%s: SearchSections() found nothing", name)
+		}
+
+		best := results[0]
+		if best.Path != "guide.md" || !reflect.DeepEqual(best.Breadcrumb, []string{"Webhooks", "Retries"}) ||
+			best.LineStart != 7 || best.LineEnd != 9 {
+			t.Errorf("%s: SearchSections()[0] = %+v, expected guide.md lines 7-9 under Webhooks › Retries", name, best)
+		}
+		if location := best.Location(); location != "guide.md › Webhooks › Retries" {
+			t.Errorf("%s: Location() = %q", name, location)
+		}
+		for _, r := range results {
+			if r.Path == "guide.md" && len(r.Breadcrumb) > 0 && r.Breadcrumb[0] == "Install" {
+				t.Errorf("%s: Install section should not match, got %+v", name, r)
+			}
+		}
+		found = append(found, results)
+	}
+	if !reflect.DeepEqual(found[0], found[1]) {
+		t.Errorf("engines disagree: %v and %v", found[0], found[1])
+	}
+}
+
+func TestSearchSections_Vouchers(t *testing.T) {
+	engine := NewSearchEngineWithOptions(os.DirFS("testData"), Options{Scorer: NewBM25Scorer()})
+	results, err := engine.SearchSections("+transaction +fields", 3)
+	if err != nil {
+		t.Fatalf("SearchSections() error = %v", err)
+	}
+	if len(results) == 0 || results[0].Path != "vouchers.md" ||
+		!reflect.DeepEqual(results[0].Breadcrumb[:2], []string{"Transaction", "Fields"}) {
+		t.Errorf("SearchSections() = %v, expected the fields of Transaction first", results)
+	}
+	for _, r := range results {
+		if r.Breadcrumb[0] != "Transaction" {
+			t.Errorf("SearchSections() = %+v, expected only sections of Transaction", r)
+		}
+	}
+
+	if results, _ := engine.SearchSections("transaction", 0); len(results) != 0 {
+		t.Errorf("SearchSections(0) = %v, expected no results", results)
+	}
+}
+
+func TestSearchSections_FileSignalsDontTie(t *testing.T) {
+	testFS := fstest.MapFS{
+		"api/pagination.md": &fstest.MapFile{Data: []byte("# Pagination\n" +
+			"Results come in pages.\n" +
+			"## Cursors\n" +
+			"Pass the cursor of the last page.\n" +
+			"## Sorting\n" +
+			"Sort by any field.")},
+	}
+
+	for _, query := range []string{"ext:md pagination", "path:api pagination"} {
+		results, err := NewSearchEngine(testFS).SearchSections(query, 10)
+		if err != nil {
+			t.Fatalf("SearchSections(%q) error = %v", query, err)
+		}
+		if len(results) != 3 {
+			t.Fatalf("SearchSections(%q) = %v, expected 3 sections", query, results)
+		}
+		// The section about pagination ranks above the ones only under it
+		if !reflect.DeepEqual(results[0].Breadcrumb, []string{"Pagination"}) || results[0].Score <= results[1].Score {
+			t.Errorf("SearchSections(%q) = %v, expected Pagination first and alone", query, results)
+		}
+		for _, r := range results {
+			if strings.Contains(r.Reason, "filename") || strings.Contains(r.Reason, "directory") {
+				t.Errorf("SearchSections(%q) reason %q, expected no path signals", query, r.Reason)
+			}
+		}
+	}
+}
@@ -0,0 +1,671 @@
+package search_engine
+
+import (
+	"sort"
+	"strings"
+)
+
+// Stemmer reduces a lowercased word to its stem, so that the forms of a word
+// such as paginate, paginated and pagination share a term
+type Stemmer interface {
+	Stem(word string) string
+}
+
+// StemFilter keeps every token and adds its stems at the same position. Exact
+// forms still match, and rank above words that only share the stem.
+type StemFilter struct {
+	Stemmers []Stemmer
+}
+
+func (f StemFilter) String() string {
+	return "stem(" + strings.Join(stemmerNames(f.Stemmers), ",") + ")"
+}
+
+// stemmerNames returns the names of the stemmers
+func stemmerNames(stemmers []Stemmer) []string {
+	names := make([]string, len(stemmers))
+	for i, stemmer := range stemmers {
+		names[i] = describe(stemmer)
+	}
+	return names
+}
+
+// Filter implements TokenFilter
+func (f StemFilter) Filter(tokens []Token) []Token {
+	var result []Token
+	for _, tok := range tokens {
+		result = append(result, tok)
+		added := map[string]bool{tok.Term: true}
+		for _, stemmer := range f.Stemmers {
+			stem := stemmer.Stem(tok.Term)
+			if !added[stem] {
+				added[stem] = true
+				alt := tok
+				alt.Term = stem
+				alt.Derived = true
+				result = append(result, alt)
+			}
+		}
+	}
+	return result
+}
+
+// English stemming
+//
+// EnglishStemmer implements the Porter2 algorithm of the Snowball project:
+// https://snowballstem.org/algorithms/english/stemmer.html
+
+// EnglishStemmer is the Snowball English (Porter2) stemmer
+type EnglishStemmer struct{}
+
+func (EnglishStemmer) String() string { return "english" }
+
+// englishExceptions are words whose stem doesn't follow the rules
+var englishExceptions = map[string]string{
+	"skis": "ski", "skies": "sky", "dying": "die", "lying": "lie", "tying": "tie",
+	"idly": "idl", "gently": "gentl", "ugly": "ugli", "early": "earli", "only": "onli",
+	"singly": "singl", "sky": "sky", "news": "news", "howe": "howe",
+	"atlas": "atlas", "cosmos": "cosmos", "bias": "bias", "andes": "andes",
+}
+
+// englishInvariants are left alone once plurals are removed
+var englishInvariants = map[string]bool{
+	"inning": true, "outing": true, "canning": true, "herring": true, "earring": true,
+	"proceed": true, "exceed": true, "succeed": true,
+}
+
+// Stem implements Stemmer
+func (EnglishStemmer) Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	if stem, ok := englishExceptions[word]; ok {
+		return stem
+	}
+
+	w := &englishWord{b: []byte(strings.TrimPrefix(word, "'"))}
+	w.markY()
+	w.setRegions()
+
+	w.step0()
+	w.step1a()
+	if englishInvariants[string(w.b)] {
+		return string(w.b)
+	}
+	w.step1b()
+	w.step1c()
+	w.step2()
+	w.step3()
+	w.step4()
+	w.step5()
+
+	return strings.ReplaceAll(string(w.b), "Y", "y")
+}
+
+// englishWord is a word being stemmed with its R1 and R2 regions
+type englishWord struct {
+	b      []byte
+	r1, r2 int
+}
+
+func isEnglishVowel(c byte) bool {
+	return c == 'a' || c == 'e' || c == 'i' || c == 'o' || c == 'u' || c == 'y'
+}
+
+// markY turns an initial y, and a y after a vowel, into a consonant Y
+func (w *englishWord) markY() {
+	for i, c := range w.b {
+		if c == 'y' && (i == 0 || isEnglishVowel(w.b[i-1])) {
+			w.b[i] = 'Y'
+		}
+	}
+}
+
+func (w *englishWord) setRegions() {
+	w.r1 = len(w.b)
+	for _, prefix := range []string{"gener", "commun", "arsen"} {
+		if strings.HasPrefix(string(w.b), prefix) {
+			w.r1 = len(prefix)
+			break
+		}
+	}
+	if w.r1 == len(w.b) {
+		w.r1 = regionAfter(w.b, 0, isEnglishVowel)
+	}
+	w.r2 = regionAfter(w.b, w.r1, isEnglishVowel)
+}
+
+// regionAfter returns the start of the region after the first non-vowel that
+// follows a vowel, looking from start
+func regionAfter(b []byte, start int, isVowel func(byte) bool) int {
+	for i := start + 1; i < len(b); i++ {
+		if !isVowel(b[i]) && isVowel(b[i-1]) {
+			return i + 1
+		}
+	}
+	return len(b)
+}
+
+func (w *englishWord) hasSuffix(suffix string) bool {
+	return len(w.b) >= len(suffix) && string(w.b[len(w.b)-len(suffix):]) == suffix
+}
+
+// longestSuffix returns the longest of the suffixes the word ends with. The
+// suffixes are sorted longest first.
+func (w *englishWord) longestSuffix(suffixes ...string) string {
+	for _, suffix := range suffixes {
+		if w.hasSuffix(suffix) {
+			return suffix
+		}
+	}
+	return ""
+}
+
+func (w *englishWord) inR1(suffix string) bool { return len(w.b)-len(suffix) >= w.r1 }
+func (w *englishWord) inR2(suffix string) bool { return len(w.b)-len(suffix) >= w.r2 }
+
+func (w *englishWord) replace(suffix, with string) {
+	w.b = append(w.b[:len(w.b)-len(suffix)], with...)
+}
+
+// hasVowelBefore reports whether the part of the word before the suffix has a vowel
+func (w *englishWord) hasVowelBefore(suffix string) bool {
+	for _, c := range w.b[:len(w.b)-len(suffix)] {
+		if isEnglishVowel(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsShortSyllable reports whether the word ends with a short syllable: a
+// non-vowel, a vowel and a non-vowel other than w, x or Y, or a vowel and a
+// non-vowel at the start of the word
+func (w *englishWord) endsShortSyllable() bool {
+	n := len(w.b)
+	if n == 2 {
+		return isEnglishVowel(w.b[0]) && !isEnglishVowel(w.b[1])
+	}
+	if n < 3 {
+		return false
+	}
+	last := w.b[n-1]
+	return !isEnglishVowel(w.b[n-3]) && isEnglishVowel(w.b[n-2]) && !isEnglishVowel(last) &&
+		last != 'w' && last != 'x' && last != 'Y'
+}
+
+// isShort reports whether the word is short: it ends with a short syllable and R1 is empty
+func (w *englishWord) isShort() bool {
+	return w.r1 >= len(w.b) && w.endsShortSyllable()
+}
+
+// step0 removes possessives
+func (w *englishWord) step0() {
+	if suffix := w.longestSuffix("'s'", "'s", "'"); suffix != "" {
+		w.replace(suffix, "")
+	}
+}
+
+// step1a removes plurals
+func (w *englishWord) step1a() {
+	switch suffix := w.longestSuffix("sses", "ied", "ies", "us", "ss", "s"); suffix {
+	case "sses":
+		w.replace(suffix, "ss")
+	case "ied", "ies":
+		if len(w.b) > 4 {
+			w.replace(suffix, "i")
+		} else {
+			w.replace(suffix, "ie")
+		}
+	case "s":
+		// Delete if a vowel comes before the letter right before the s
+		if len(w.b) > 2 && strings.ContainsAny(string(w.b[:len(w.b)-2]), "aeiouy") {
+			w.replace(suffix, "")
+		}
+	}
+}
+
+// step1b removes -ed and -ing
+func (w *englishWord) step1b() {
+	switch suffix := w.longestSuffix("eedly", "ingly", "edly", "eed", "ing", "ed"); suffix {
+	case "":
+		return
+	case "eed", "eedly":
+		if w.inR1(suffix) {
+			w.replace(suffix, "ee")
+		}
+	default:
+		if !w.hasVowelBefore(suffix) {
+			return
+		}
+		w.replace(suffix, "")
+		switch {
+		case w.hasSuffix("at") || w.hasSuffix("bl") || w.hasSuffix("iz"):
+			w.b = append(w.b, 'e')
+		case w.endsDouble():
+			w.b = w.b[:len(w.b)-1]
+		case w.isShort():
+			w.b = append(w.b, 'e')
+		}
+	}
+}
+
+// endsDouble reports whether the word ends with a doubled consonant such as tt
+func (w *englishWord) endsDouble() bool {
+	for _, double := range []string{"bb", "dd", "ff", "gg", "mm", "nn", "pp", "rr", "tt"} {
+		if w.hasSuffix(double) {
+			return true
+		}
+	}
+	return false
+}
+
+// step1c turns a final y after a consonant into i, as in happy
+func (w *englishWord) step1c() {
+	n := len(w.b)
+	if n > 2 && (w.b[n-1] == 'y' || w.b[n-1] == 'Y') && !isEnglishVowel(w.b[n-2]) {
+		w.b[n-1] = 'i'
+	}
+}
+
+// englishStep2 maps the suffixes removed by step 2 to their replacements
+var englishStep2 = map[string]string{
+	"tional": "tion", "enci": "ence", "anci": "ance", "abli": "able", "entli": "ent",
+	"izer": "ize", "ization": "ize", "ational": "ate", "ation": "ate", "ator": "ate",
+	"alism": "al", "aliti": "al", "alli": "al", "fulness": "ful", "ousli": "ous",
+	"ousness": "ous", "iveness": "ive", "iviti": "ive", "biliti": "ble", "bli": "ble",
+	"ogi": "og", "fulli": "ful", "lessli": "less", "li": "",
+}
+
+// englishStep2Suffixes are the suffixes of step 2, longest first
+var englishStep2Suffixes = longestFirst(mapKeys(englishStep2))
+
+func (w *englishWord) step2() {
+	suffix := w.longestSuffix(englishStep2Suffixes...)
+	if suffix == "" || !w.inR1(suffix) {
+		return
+	}
+	before := w.b[:len(w.b)-len(suffix)]
+	switch suffix {
+	case "ogi":
+		if len(before) == 0 || before[len(before)-1] != 'l' {
+			return
+		}
+	case "li":
+		if len(before) == 0 || !strings.ContainsRune("cdeghkmnrt", rune(before[len(before)-1])) {
+			return
+		}
+	}
+	w.replace(suffix, englishStep2[suffix])
+}
+
+// englishStep3 maps the suffixes removed by step 3 to their replacements
+var englishStep3 = map[string]string{
+	"tional": "tion", "ational": "ate", "alize": "al", "icate": "ic", "iciti": "ic",
+	"ical": "ic", "ful": "", "ness": "", "ative": "",
+}
+
+// englishStep3Suffixes are the suffixes of step 3, longest first
+var englishStep3Suffixes = longestFirst(mapKeys(englishStep3))
+
+func (w *englishWord) step3() {
+	suffix := w.longestSuffix(englishStep3Suffixes...)
+	if suffix == "" || !w.inR1(suffix) {
+		return
+	}
+	if suffix == "ative" && !w.inR2(suffix) {
+		return
+	}
+	w.replace(suffix, englishStep3[suffix])
+}
+
+// englishStep4 are the suffixes removed by step 4, longest first
+var englishStep4 = longestFirst([]string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment", "ent",
+	"ism", "ate", "iti", "ous", "ive", "ize", "ion",
+})
+
+func (w *englishWord) step4() {
+	suffix := w.longestSuffix(englishStep4...)
+	if suffix == "" || !w.inR2(suffix) {
+		return
+	}
+	if suffix == "ion" {
+		before := w.b[:len(w.b)-len(suffix)]
+		if len(before) == 0 || (before[len(before)-1] != 's' && before[len(before)-1] != 't') {
+			return
+		}
+	}
+	w.replace(suffix, "")
+}
+
+// step5 removes a final e or the second l of a final ll
+func (w *englishWord) step5() {
+	switch {
+	case w.hasSuffix("e"):
+		if w.inR2("e") {
+			w.replace("e", "")
+			return
+		}
+		if w.inR1("e") {
+			rest := &englishWord{b: w.b[:len(w.b)-1]}
+			if !rest.endsShortSyllable() {
+				w.replace("e", "")
+			}
+		}
+	case w.hasSuffix("ll"):
+		if w.inR2("l") {
+			w.replace("l", "")
+		}
+	}
+}
+
+// mapKeys returns the keys of a map
+func mapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// longestFirst sorts suffixes longest first, in alphabetical order among the
+// ones of the same length
+func longestFirst(suffixes []string) []string {
+	sort.Slice(suffixes, func(i, j int) bool {
+		if len(suffixes[i]) != len(suffixes[j]) {
+			return len(suffixes[i]) > len(suffixes[j])
+		}
+		return suffixes[i] < suffixes[j]
+	})
+	return suffixes
+}
+
+// Spanish stemming
+//
+// SpanishStemmer implements the Spanish algorithm of the Snowball project:
+// https://snowballstem.org/algorithms/spanish/stemmer.html
+
+// SpanishStemmer is the Snowball Spanish stemmer
+type SpanishStemmer struct{}
+
+func (SpanishStemmer) String() string { return "spanish" }
+
+// Stem implements Stemmer
+func (SpanishStemmer) Stem(word string) string {
+	w := &spanishWord{r: []rune(word)}
+	w.setRegions()
+
+	w.step0()
+	if !w.step1() && !w.step2a() {
+		w.step2b()
+	}
+	w.step3()
+
+	return removeAcuteAccents(string(w.r))
+}
+
+// spanishWord is a word being stemmed with its RV, R1 and R2 regions
+type spanishWord struct {
+	r          []rune
+	rv, r1, r2 int
+}
+
+func isSpanishVowel(r rune) bool {
+	return strings.ContainsRune("aeiouáéíóúü", r)
+}
+
+func (w *spanishWord) setRegions() {
+	n := len(w.r)
+	w.rv = n
+	if n >= 2 {
+		switch {
+		case !isSpanishVowel(w.r[1]):
+			// After the next vowel following the second letter
+			for i := 2; i < n; i++ {
+				if isSpanishVowel(w.r[i]) {
+					w.rv = i + 1
+					break
+				}
+			}
+		case isSpanishVowel(w.r[0]):
+			// After the next consonant following the second letter
+			for i := 2; i < n; i++ {
+				if !isSpanishVowel(w.r[i]) {
+					w.rv = i + 1
+					break
+				}
+			}
+		default:
+			w.rv = min(3, n)
+		}
+	}
+
+	w.r1 = n
+	for i := 1; i < n; i++ {
+		if !isSpanishVowel(w.r[i]) && isSpanishVowel(w.r[i-1]) {
+			w.r1 = i + 1
+			break
+		}
+	}
+	w.r2 = n
+	for i := w.r1 + 1; i < n; i++ {
+		if !isSpanishVowel(w.r[i]) && isSpanishVowel(w.r[i-1]) {
+			w.r2 = i + 1
+			break
+		}
+	}
+}
+
+func (w *spanishWord) hasSuffix(suffix string) bool {
+	return strings.HasSuffix(string(w.r), suffix)
+}
+
+// longestSuffix returns the longest of the suffixes the word ends with,
+// starting no earlier than from
+func (w *spanishWord) longestSuffix(from int, suffixes []string) string {
+	longest := ""
+	for _, suffix := range suffixes {
+		n := len([]rune(suffix))
+		if n > len([]rune(longest)) && len(w.r)-n >= from && w.hasSuffix(suffix) {
+			longest = suffix
+		}
+	}
+	return longest
+}
+
+// starts returns the position where a suffix of the word starts
+func (w *spanishWord) starts(suffix string) int {
+	return len(w.r) - len([]rune(suffix))
+}
+
+func (w *spanishWord) replace(suffix, with string) {
+	w.r = append(w.r[:w.starts(suffix)], []rune(with)...)
+}
+
+// removeIn removes a suffix if it starts in a region
+func (w *spanishWord) removeIn(region int, suffix string) bool {
+	if w.hasSuffix(suffix) && w.starts(suffix) >= region {
+		w.replace(suffix, "")
+		return true
+	}
+	return false
+}
+
+var spanishPronouns = []string{
+	"me", "se", "sela", "selo", "selas", "selos", "la", "le", "lo", "las", "les", "los", "nos",
+}
+
+// step0 removes attached pronouns, as in buscándola
+func (w *spanishWord) step0() {
+	pronoun := w.longestSuffix(w.rv, spanishPronouns)
+	if pronoun == "" {
+		return
+	}
+
+	before := &spanishWord{r: w.r[:w.starts(pronoun)], rv: w.rv}
+	accented := map[string]string{"iéndo": "iendo", "ándo": "ando", "ár": "ar", "ér": "er", "ír": "ir"}
+	for _, ending := range []string{"iéndo", "ándo", "ár", "ér", "ír"} {
+		if before.hasSuffix(ending) && before.starts(ending) >= w.rv {
+			w.r = append(before.r[:before.starts(ending)], []rune(accented[ending])...)
+			return
+		}
+	}
+	for _, ending := range []string{"iendo", "ando", "ar", "er", "ir"} {
+		if before.hasSuffix(ending) && before.starts(ending) >= w.rv {
+			w.replace(pronoun, "")
+			return
+		}
+	}
+	if before.hasSuffix("uyendo") && before.starts("yendo") >= w.rv {
+		w.replace(pronoun, "")
+	}
+}
+
+var spanishStep1 = []string{
+	"anza", "anzas", "ico", "ica", "icos", "icas", "ismo", "ismos", "able", "ables",
+	"ible", "ibles", "ista", "istas", "oso", "osa", "osos", "osas", "amiento",
+	"amientos", "imiento", "imientos",
+	"adora", "ador", "ación", "adoras", "adores", "aciones", "ante", "antes", "ancia", "ancias",
+	"logía", "logías", "ución", "uciones", "encia", "encias", "amente", "mente",
+	"idad", "idades", "iva", "ivo", "ivas", "ivos",
+}
+
+// step1 removes standard suffixes and reports whether it did
+func (w *spanishWord) step1() bool {
+	suffix := w.longestSuffix(0, spanishStep1)
+	if suffix == "" {
+		return false
+	}
+
+	inR2 := w.starts(suffix) >= w.r2
+	switch suffix {
+	case "adora", "ador", "ación", "adoras", "adores", "aciones", "ante", "antes", "ancia", "ancias":
+		if !inR2 {
+			return false
+		}
+		w.replace(suffix, "")
+		w.removeIn(w.r2, "ic")
+	case "logía", "logías":
+		if !inR2 {
+			return false
+		}
+		w.replace(suffix, "log")
+	case "ución", "uciones":
+		if !inR2 {
+			return false
+		}
+		w.replace(suffix, "u")
+	case "encia", "encias":
+		if !inR2 {
+			return false
+		}
+		w.replace(suffix, "ente")
+	case "amente":
+		if w.starts(suffix) < w.r1 {
+			return false
+		}
+		w.replace(suffix, "")
+		if w.removeIn(w.r2, "iv") {
+			w.removeIn(w.r2, "at")
+		} else {
+			for _, s := range []string{"os", "ic", "ad"} {
+				if w.removeIn(w.r2, s) {
+					break
+				}
+			}
+		}
+	case "mente":
+		if !inR2 {
+			return false
+		}
+		w.replace(suffix, "")
+		for _, s := range []string{"ante", "able", "ible"} {
+			if w.removeIn(w.r2, s) {
+				break
+			}
+		}
+	case "idad", "idades":
+		if !inR2 {
+			return false
+		}
+		w.replace(suffix, "")
+		for _, s := range []string{"abil", "ic", "iv"} {
+			if w.removeIn(w.r2, s) {
+				break
+			}
+		}
+	case "iva", "ivo", "ivas", "ivos":
+		if !inR2 {
+			return false
+		}
+		w.replace(suffix, "")
+		w.removeIn(w.r2, "at")
+	default:
+		if !inR2 {
+			return false
+		}
+		w.replace(suffix, "")
+	}
+	return true
+}
+
+var spanishStep2a = []string{"ya", "ye", "yan", "yen", "yeron", "yendo", "yo", "yó", "yas", "yes", "yais", "yamos"}
+
+// step2a removes verb suffixes beginning with y after a u, as in construyendo
+func (w *spanishWord) step2a() bool {
+	suffix := w.longestSuffix(w.rv, spanishStep2a)
+	if suffix == "" {
+		return false
+	}
+	if start := w.starts(suffix); start == 0 || w.r[start-1] != 'u' {
+		return false
+	}
+	w.replace(suffix, "")
+	return true
+}
+
+var spanishStep2b = []string{
+	"en", "es", "éis", "emos",
+	"arían", "arías", "arán", "arás", "aríais", "aría", "aréis", "aríamos", "aremos", "ará", "aré",
+	"erían", "erías", "erán", "erás", "eríais", "ería", "eréis", "eríamos", "eremos", "erá", "eré",
+	"irían", "irías", "irán", "irás", "iríais", "iría", "iréis", "iríamos", "iremos", "irá", "iré",
+	"aba", "ada", "ida", "ía", "ara", "iera", "ad", "ed", "id", "ase", "iese", "aste", "iste",
+	"an", "aban", "ían", "aran", "ieran", "asen", "iesen", "aron", "ieron", "ado", "ido", "ando",
+	"iendo", "ió", "ar", "er", "ir", "as", "abas", "adas", "idas", "ías", "aras", "ieras", "ases",
+	"ieses", "ís", "áis", "abais", "íais", "arais", "ierais", "aseis", "ieseis", "asteis",
+	"isteis", "ados", "idos", "amos", "ábamos", "íamos", "imos", "áramos", "iéramos", "iésemos",
+	"ásemos",
+}
+
+// step2b removes the other verb suffixes
+func (w *spanishWord) step2b() {
+	suffix := w.longestSuffix(w.rv, spanishStep2b)
+	if suffix == "" {
+		return
+	}
+	w.replace(suffix, "")
+	switch suffix {
+	case "en", "es", "éis", "emos":
+		if w.hasSuffix("gu") {
+			w.r = w.r[:len(w.r)-1]
+		}
+	}
+}
+
+// step3 removes a residual vowel
+func (w *spanishWord) step3() {
+	suffix := w.longestSuffix(w.rv, []string{"os", "a", "o", "á", "í", "ó", "e", "é"})
+	if suffix == "" {
+		return
+	}
+	w.replace(suffix, "")
+	if (suffix == "e" || suffix == "é") && w.hasSuffix("gu") && len(w.r)-1 >= w.rv {
+		w.r = w.r[:len(w.r)-1]
+	}
+}
+
+// removeAcuteAccents replaces á, é, í, ó and ú with unaccented vowels
+func removeAcuteAccents(s string) string {
+	return strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u").Replace(s)
+}
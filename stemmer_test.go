@@ -0,0 +1,131 @@
+package search_engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEnglishStemmer(t *testing.T) {
+	tests := []struct {
+		word     string
+		expected string
+	}{
+		{"pagination", "pagin"},
+		{"paginated", "pagin"},
+		{"paginate", "pagin"},
+		{"vouchers", "voucher"},
+		{"running", "run"},
+		{"generously", "generous"},
+		{"happiness", "happi"},
+		{"skies", "sky"},
+		{"api", "api"},
+	}
+
+	for _, tt := range tests {
+		if got := (EnglishStemmer{}).Stem(tt.word); got != tt.expected {
+			t.Errorf("Stem(%q) = %q, expected %q", tt.word, got, tt.expected)
+		}
+	}
+}
+
+func TestSpanishStemmer(t *testing.T) {
+	tests := []struct {
+		word     string
+		expected string
+	}{
+		{"paginación", "pagin"},
+		{"paginar", "pagin"},
+		{"páginas", "pagin"},
+		{"creaciones", "creacion"},
+		{"usuarios", "usuari"},
+		{"autenticación", "autent"},
+	}
+
+	for _, tt := range tests {
+		if got := (SpanishStemmer{}).Stem(tt.word); got != tt.expected {
+			t.Errorf("Stem(%q) = %q, expected %q", tt.word, got, tt.expected)
+		}
+	}
+}
+
+func TestStemFilter(t *testing.T) {
+	analyzer := NewAnalyzer(WordTokenizer{}, StemFilter{Stemmers: []Stemmer{EnglishStemmer{}, SpanishStemmer{}}})
+
+	tokens := analyzer.Analyze("pagination api")
+	expected := []Token{
+		{Term: "pagination", Position: 0, Start: 0, End: 10},
+		{Term: "pagin", Position: 0, Start: 0, End: 10, Derived: true},
+		{Term: "api", Position: 1, Start: 11, End: 14},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Analyze() = %+v, expected %+v", tokens, expected)
+	}
+	if got := analyzer.String(); got != "word|stem(english,spanish)" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestParseLanguages(t *testing.T) {
+	languages, err := ParseLanguages("en, Spanish")
+	if err != nil || !reflect.DeepEqual(languages, []Language{English, Spanish}) {
+		t.Errorf("ParseLanguages() = %v, %v", languages, err)
+	}
+	if _, err := ParseLanguages("en,fr"); err == nil {
+		t.Error("ParseLanguages() expected an error for fr")
+	}
+}
+
+func TestFindRelevantFiles_Stemming(t *testing.T) {
+	testFS := fstest.MapFS{
+		"pagination.md": &fstest.MapFile{Data: []byte("# Pagination\n\nResults are paginated with a cursor.")},
+		"paginacion.md": &fstest.MapFile{Data: []byte("---\nlang: es\n---\n# Paginación\n\nLos resultados se paginan con un cursor.")},
+		"webhooks.md":   &fstest.MapFile{Data: []byte("# Webhooks\n\nEvents are sent to your endpoint.")},
+	}
+
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngine(testFS), "index": indexed} {
+		for _, query := range []string{"paginar", "paginación", "paginated", "paginate"} {
+			results, err := engine.FindRelevantFiles(query, 10)
+			if err != nil {
+				t.Fatalf("FindRelevantFiles() error = %v", err)
+			}
+			var paths []string
+			for _, r := range results {
+				paths = append(paths, r.Path)
+			}
+			if len(paths) != 2 || strings.Contains(strings.Join(paths, " "), "webhooks.md") {
+				t.Errorf("%s: FindRelevantFiles(%q) = %v, expected both pagination docs", name, query, paths)
+			}
+		}
+
+		// The exact form ranks first
+		results, _ := engine.FindRelevantFiles("paginated", 10)
+		if len(results) == 0 || results[0].Path != "pagination.md" {
+			t.Errorf("%s: FindRelevantFiles(paginated) = %v, expected pagination.md first", name, results)
+		}
+	}
+}
+
+func TestDeclaredLanguage(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected Language
+	}{
+		{"---\ntitle: Guía\nlang: es\n---\n# Guía", Spanish},
+		{"---\nlanguage: \"english\"\n---\n", English},
+		{`<html lang="es"><body>Hola</body></html>`, Spanish},
+		{"# Guide\n\nlang: es", ""},
+	}
+
+	for _, tt := range tests {
+		if got := declaredLanguage(tt.content); got != tt.expected {
+			t.Errorf("declaredLanguage(%q) = %q, expected %q", tt.content, got, tt.expected)
+		}
+	}
+}
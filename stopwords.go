@@ -0,0 +1,105 @@
+package search_engine
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// StopWords is a set of lowercased words dropped from queries
+type StopWords map[string]bool
+
+// stopWordLists are the built-in lists of stop words by name
+var stopWordLists = map[string]StopWords{
+	"english": englishStopWords,
+	"spanish": spanishStopWords,
+	"none":    {},
+}
+
+// StopWordList returns a copy of a built-in list of stop words: "english",
+// "spanish" or "none"
+func StopWordList(name string) (StopWords, error) {
+	list, ok := stopWordLists[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("unknown stop word list %q (want english, spanish or none)", name)
+	}
+	words := make(StopWords, len(list))
+	for word := range list {
+		words[word] = true
+	}
+	return words, nil
+}
+
+// ParseStopWords returns the stop words of a spec: a comma separated list of
+// built-in lists such as "english,spanish", or the path of a stop word file
+func ParseStopWords(spec string) (StopWords, error) {
+	if _, err := os.Stat(spec); err == nil {
+		return LoadStopWords(spec)
+	}
+
+	words := make(StopWords)
+	for _, name := range strings.Split(spec, ",") {
+		list, err := StopWordList(name)
+		if err != nil {
+			return nil, err
+		}
+		for word := range list {
+			words[word] = true
+		}
+	}
+	return words, nil
+}
+
+// LoadStopWords reads a stop word file
+func LoadStopWords(path string) (StopWords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadStopWords(f)
+}
+
+// ReadStopWords reads stop words separated by spaces, commas or new lines.
+// Text after a # is a comment.
+func ReadStopWords(r io.Reader) (StopWords, error) {
+	words := make(StopWords)
+	err := scanListLines(r, func(_ int, line string) error {
+		for _, word := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			words[foldCase(word)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// sorted returns the stop words in alphabetical order
+func (s StopWords) sorted() []string {
+	words := make([]string, 0, len(s))
+	for word := range s {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// withoutStopWords returns the analyzer without its stop word filters, for the
+// words of quoted phrases. Analyzers other than a Pipeline are returned as is.
+func withoutStopWords(analyzer Analyzer) Analyzer {
+	p, ok := analyzer.(*Pipeline)
+	if !ok {
+		return analyzer
+	}
+	filters := make([]TokenFilter, 0, len(p.Filters))
+	for _, filter := range p.Filters {
+		if _, stop := filter.(StopWordFilter); !stop {
+			filters = append(filters, filter)
+		}
+	}
+	return NewAnalyzer(p.Tokenizer, filters...)
+}
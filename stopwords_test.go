@@ -0,0 +1,102 @@
+package search_engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseStopWords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stopwords.txt")
+	if err := os.WriteFile(path, []byte("# Team list\nThe, a\nof  to # prepositions\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		spec     string
+		expected []string // Words of the list checked for
+		missing  []string // Words that must not be in the list
+	}{
+		{"english", []string{"the", "it", "will"}, []string{"la"}},
+		{"spanish", []string{"la", "de"}, []string{"the"}},
+		{"english, spanish", []string{"the", "la"}, nil},
+		{"none", nil, []string{"the", "la"}},
+		{path, []string{"the", "a", "of", "to"}, []string{"it", "#", "prepositions"}},
+	}
+
+	for _, tt := range tests {
+		words, err := ParseStopWords(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseStopWords(%q) error = %v", tt.spec, err)
+		}
+		for _, word := range tt.expected {
+			if !words[word] {
+				t.Errorf("ParseStopWords(%q) should contain %q", tt.spec, word)
+			}
+		}
+		for _, word := range tt.missing {
+			if words[word] {
+				t.Errorf("ParseStopWords(%q) should not contain %q", tt.spec, word)
+			}
+		}
+	}
+
+	if _, err := ParseStopWords("french"); err == nil {
+		t.Error("ParseStopWords(french) expected an error")
+	}
+}
+
+func TestParseQuery_StopWords(t *testing.T) {
+	none, _ := StopWordList("none")
+
+	tests := []struct {
+		query    string
+		opts     Options
+		expected []string
+	}{
+		{"it department", Options{}, []string{"department", "depart"}},
+		{`"it department"`, Options{}, []string{"it department", "department", "depart"}},
+		{`"sign in"`, Options{}, []string{"sign in", "sign"}},
+		{`"it"`, Options{}, []string{"it"}},
+		{"it department", Options{StopWords: none}, []string{"it", "department", "depart"}},
+		{"the voucher", Options{StopWords: StopWords{"voucher": true}}, []string{"the"}},
+	}
+
+	for _, tt := range tests {
+		q, err := parseQuery(tt.query, tt.opts.analyzers())
+		if err != nil {
+			t.Fatalf("parseQuery(%q) error = %v", tt.query, err)
+		}
+		if got := q.Terms(); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("parseQuery(%q).Terms() = %v, expected %v", tt.query, got, tt.expected)
+		}
+	}
+}
+
+func TestFindRelevantFiles_StopWords(t *testing.T) {
+	testFS := fstest.MapFS{
+		"it.md":        &fstest.MapFile{Data: []byte("# IT department\n\nThe IT department manages laptops.")},
+		"marketing.md": &fstest.MapFile{Data: []byte("# Marketing department\n\nThe marketing department runs campaigns.")},
+	}
+	none, _ := StopWordList("none")
+
+	for _, query := range []string{`"IT department"`, "+it department"} {
+		results, err := NewSearchEngineWithOptions(testFS, Options{StopWords: none}).FindRelevantFiles(query, 10)
+		if err != nil {
+			t.Fatalf("FindRelevantFiles() error = %v", err)
+		}
+		if len(results) == 0 || results[0].Path != "it.md" {
+			t.Errorf("FindRelevantFiles(%q) = %v, expected it.md first", query, results)
+		}
+	}
+
+	results, err := NewSearchEngine(testFS).FindRelevantFiles(`"IT department"`, 10)
+	if err != nil {
+		t.Fatalf("FindRelevantFiles() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Path != "it.md" {
+		t.Errorf("FindRelevantFiles() = %v, expected only it.md", results)
+	}
+}
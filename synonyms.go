@@ -0,0 +1,340 @@
+package search_engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DefaultSynonymWeight is the weight of a synonym relative to the word it
+// expands, so that a page using the word itself ranks first
+const DefaultSynonymWeight = 0.5
+
+// Synonyms expands query words and phrases to other words and phrases, such as
+// auth to login, token and "sign in". Words are matched case-insensitively.
+type Synonyms struct {
+	// Weight multiplies the contribution of a synonym. Defaults to
+	// DefaultSynonymWeight.
+	Weight float64
+
+	expansions map[string][]string
+	maxWords   int // Words of the longest word or phrase with synonyms
+}
+
+// NewSynonyms creates an empty set of synonyms
+func NewSynonyms() *Synonyms {
+	return &Synonyms{expansions: make(map[string][]string)}
+}
+
+// synonymKey normalizes a word or phrase for lookups
+func synonymKey(text string) string {
+	return strings.Join(strings.Fields(foldCase(text)), " ")
+}
+
+// Add makes the synonyms expansions of term, but not the other way around
+func (s *Synonyms) Add(term string, synonyms ...string) {
+	key := synonymKey(term)
+	for _, synonym := range synonyms {
+		synonym = synonymKey(synonym)
+		if synonym == "" || synonym == key || slices.Contains(s.expansions[key], synonym) {
+			continue
+		}
+		s.expansions[key] = append(s.expansions[key], synonym)
+		s.maxWords = max(s.maxWords, len(strings.Fields(key)))
+	}
+}
+
+// AddGroup makes all the words of a group synonyms of each other
+func (s *Synonyms) AddGroup(words ...string) {
+	for _, word := range words {
+		s.Add(word, words...)
+	}
+}
+
+// Lookup returns the synonyms of a word or phrase, nil when it has none
+func (s *Synonyms) Lookup(term string) []string {
+	if s == nil {
+		return nil
+	}
+	return s.expansions[synonymKey(term)]
+}
+
+// maxKeyWords returns the number of words of the longest word or phrase with
+// synonyms, 0 when there is none
+func (s *Synonyms) maxKeyWords() int {
+	if s == nil {
+		return 0
+	}
+	return s.maxWords
+}
+
+// Len returns the number of words and phrases with synonyms
+func (s *Synonyms) Len() int {
+	return len(s.expansions)
+}
+
+// weight returns the configured synonym weight or the default one
+func (s *Synonyms) weight() float64 {
+	if s.Weight <= 0 {
+		return DefaultSynonymWeight
+	}
+	return s.Weight
+}
+
+// SynonymNode matches a word or phrase of the query or any of its synonyms.
+// Synonyms add less to the score than the word itself.
+type SynonymNode struct {
+	Child    Node    // TermNode or PhraseNode as written in the query
+	Original string  // Word or phrase the synonyms were looked up for
+	Synonyms []Node  // TermNode or PhraseNode of every synonym
+	Weight   float64 // Weight of the synonyms
+}
+
+func (n *SynonymNode) String() string {
+	return "(" + n.Child.String() + " OR " + joinNodes(n.Synonyms, " OR ") + ")"
+}
+
+func (n *SynonymNode) matches(doc *Document) bool {
+	if n.Child.matches(doc) {
+		return true
+	}
+	for _, synonym := range n.Synonyms {
+		if synonym.matches(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectTerms adds the terms of the child and the terms of the synonyms, with
+// the lower weight of a synonym
+func (n *SynonymNode) collectTerms(positive, negative *[]QueryTerm, negated bool) {
+	n.Child.collectTerms(positive, negative, negated)
+
+	var synPositive, synNegative []QueryTerm
+	for _, synonym := range n.Synonyms {
+		synonym.collectTerms(&synPositive, &synNegative, negated)
+	}
+	for _, term := range synPositive {
+		term.Weight = term.weight() * n.Weight
+		term.Expansion, term.Original = "synonym", n.Original
+		*positive = append(*positive, term)
+	}
+	*negative = append(*negative, synNegative...)
+}
+
+// synonymNode wraps the node of a query word or phrase with its synonyms, or
+// returns the node itself when it has none
+func (p *queryParser) synonymNode(node Node, text string) Node {
+	synonyms := p.analysis.synonyms.Lookup(text)
+	if node == nil || len(synonyms) == 0 {
+		return node
+	}
+
+	n := &SynonymNode{Child: node, Original: synonymKey(text), Weight: p.analysis.synonyms.weight()}
+	for _, synonym := range synonyms {
+		var child Node
+		if words := analyzeWords(p.analysis.document, synonym); len(words) > 1 {
+			// Only the whole phrase counts, not "sign" alone for "sign in"
+			child = &PhraseNode{Text: synonym, Words: words}
+		} else if terms := uniqueStrings(analyzeTerms(p.analysis.query, synonym)); len(terms) > 0 {
+			child = &TermNode{Text: synonym, Terms: terms}
+		}
+		if child != nil {
+			n.Synonyms = append(n.Synonyms, child)
+		}
+	}
+	if len(n.Synonyms) == 0 {
+		return node
+	}
+	return n
+}
+
+// synonymRun parses the longest run of query words, starting at the current
+// one, that has synonyms as a phrase, such as sign in. Each word of the run
+// still matches on its own, as written. It returns nil, reading nothing, when
+// no run of two words or more has synonyms.
+func (p *queryParser) synonymRun() Node {
+	for n := min(p.analysis.synonyms.maxKeyWords(), len(p.tokens)-p.pos); n > 1; n-- {
+		words := make([]string, 0, n)
+		for _, tok := range p.tokens[p.pos : p.pos+n] {
+			if tok.kind != queryWord {
+				break
+			}
+			words = append(words, tok.text)
+		}
+		text := strings.Join(words, " ")
+		if len(words) < n || len(p.analysis.synonyms.Lookup(text)) == 0 {
+			continue
+		}
+
+		p.pos += n
+		bag := &BoolNode{}
+		for _, word := range words {
+			if node := p.wordNode(word); node != nil {
+				bag.Should = append(bag.Should, node)
+			}
+		}
+		child := simplifyBag(bag)
+		if child == nil {
+			// A run of stop words only counts as the phrase it is
+			child = &PhraseNode{Text: text, Words: analyzeWords(p.analysis.document, text)}
+		}
+		return p.synonymNode(child, text)
+	}
+	return nil
+}
+
+// LoadSynonyms reads a synonym file, in the YAML format when its extension is
+// .yaml or .yml and in the text format otherwise
+func LoadSynonyms(path string) (*Synonyms, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseSynonymsYAML(f)
+	}
+	return ParseSynonyms(f)
+}
+
+// ParseSynonyms reads synonyms in the text format, one rule per line:
+//
+//	# Comments start with # at the start of a line or after a space
+//	auth, login, token, sign in     # Synonyms of each other
+//	api key => token, credentials   # Synonyms of api key only
+func ParseSynonyms(r io.Reader) (*Synonyms, error) {
+	s := NewSynonyms()
+	err := scanListLines(r, func(n int, line string) error {
+		if term, synonyms, found := strings.Cut(line, "=>"); found {
+			if strings.TrimSpace(term) == "" {
+				return fmt.Errorf("line %d: missing word before =>", n)
+			}
+			s.Add(term, splitSynonyms(synonyms)...)
+			return nil
+		}
+		s.AddGroup(splitSynonyms(line)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ParseSynonymsYAML reads synonyms in a subset of YAML. A mapping gives the
+// synonyms of each key, and a list item is a group of synonyms of each other:
+//
+//	auth: [login, token, sign in]
+//	api key:
+//	  - credentials
+//	- [webhook, callback, notification]
+//
+// The items of a key may also be written at the indentation of the key itself,
+// as YAML allows.
+func ParseSynonymsYAML(r io.Reader) (*Synonyms, error) {
+	s := NewSynonyms()
+	key := ""              // Key whose block list is being read
+	keyItems := 0          // Items of the key read so far
+	itemsIndented := false // Whether the items of the key are indented
+	err := scanListLines(r, func(n int, line string) error {
+		indented := line[0] == ' ' || line[0] == '\t'
+		line = strings.TrimSpace(line)
+
+		if item, ok := strings.CutPrefix(line, "-"); ok {
+			item = strings.TrimSpace(item)
+			// The first item sets the indentation of the list, and an item
+			// at another one ends it
+			if key != "" && (keyItems == 0 || indented == itemsIndented) {
+				s.Add(key, yamlScalar(item))
+				keyItems++
+				itemsIndented = indented
+				return nil
+			}
+			key = ""
+			s.AddGroup(yamlList(item)...)
+			return nil
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found || indented {
+			return fmt.Errorf("line %d: expected \"word: synonyms\" or \"- [synonyms]\"", n)
+		}
+		key, keyItems = yamlScalar(name), 0
+		if value = strings.TrimSpace(value); value != "" {
+			s.Add(key, yamlList(value)...)
+			key = ""
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// scanListLines calls fn with the number and text of every line that isn't
+// blank or a comment, without trailing comments
+func scanListLines(r io.Reader, fn func(n int, line string) error) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(withoutComment(scanner.Text()), " \t")
+		if strings.TrimSpace(line) == "" || line == "---" {
+			continue
+		}
+		if err := fn(n, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// withoutComment returns a line without its comment. A comment starts with a #
+// at the start of the line or after whitespace, so that c# is a word.
+func withoutComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitSynonyms splits a comma separated list of words and phrases
+func splitSynonyms(list string) []string {
+	var words []string
+	for _, word := range strings.Split(list, ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// yamlList parses a flow sequence such as [a, "b c"] or a plain comma
+// separated list
+func yamlList(value string) []string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	words := splitSynonyms(value)
+	for i, word := range words {
+		words[i] = yamlScalar(word)
+	}
+	return words
+}
+
+// yamlScalar removes the quotes around a scalar
+func yamlScalar(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
@@ -0,0 +1,180 @@
+package search_engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseSynonyms(t *testing.T) {
+	s, err := ParseSynonyms(strings.NewReader(`
+# Authentication
+Auth, login, sign in
+api key => token, credentials   # One way only
+c#, csharp #C sharp
+f# => fsharp
+`))
+	if err != nil {
+		t.Fatalf("ParseSynonyms() error = %v", err)
+	}
+
+	tests := []struct {
+		term     string
+		expected []string
+	}{
+		{"auth", []string{"login", "sign in"}},
+		{"Sign  In", []string{"auth", "login"}},
+		{"api key", []string{"token", "credentials"}},
+		{"token", nil},
+		{"c#", []string{"csharp"}},
+		{"f#", []string{"fsharp"}},
+	}
+	for _, tt := range tests {
+		if got := s.Lookup(tt.term); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Lookup(%q) = %v, expected %v", tt.term, got, tt.expected)
+		}
+	}
+
+	if _, err := ParseSynonyms(strings.NewReader("=> token")); err == nil {
+		t.Error("ParseSynonyms() expected an error for a rule without a word")
+	}
+}
+
+func TestParseSynonymsYAML(t *testing.T) {
+	s, err := ParseSynonymsYAML(strings.NewReader(`---
+auth: [login, "sign in"]
+api key:
+  - token
+  - 'credentials'
+- [webhook, callback]
+c#: [csharp] # C sharp
+`))
+	if err != nil {
+		t.Fatalf("ParseSynonymsYAML() error = %v", err)
+	}
+
+	tests := []struct {
+		term     string
+		expected []string
+	}{
+		{"auth", []string{"login", "sign in"}},
+		{"login", nil},
+		{"api key", []string{"token", "credentials"}},
+		{"callback", []string{"webhook"}},
+		{"c#", []string{"csharp"}},
+	}
+	for _, tt := range tests {
+		if got := s.Lookup(tt.term); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Lookup(%q) = %v, expected %v", tt.term, got, tt.expected)
+		}
+	}
+
+	// Items at the indentation of their key, then a group
+	s, err = ParseSynonymsYAML(strings.NewReader("auth:\n- login\n- token\nwebhook:\n- callback\n"))
+	if err != nil {
+		t.Fatalf("ParseSynonymsYAML() error = %v", err)
+	}
+	if got := s.Lookup("auth"); !reflect.DeepEqual(got, []string{"login", "token"}) {
+		t.Errorf("Lookup(auth) = %v, expected [login token]", got)
+	}
+	if got := s.Lookup("webhook"); !reflect.DeepEqual(got, []string{"callback"}) {
+		t.Errorf("Lookup(webhook) = %v, expected [callback]", got)
+	}
+
+	if _, err := ParseSynonymsYAML(strings.NewReader("auth\n")); err == nil {
+		t.Error("ParseSynonymsYAML() expected an error for a line without a colon")
+	}
+}
+
+func TestParseQuery_Synonyms(t *testing.T) {
+	synonyms := NewSynonyms()
+	synonyms.AddGroup("auth", "login", "sign in")
+
+	q, err := parseQuery("auth -webhook", Options{Synonyms: synonyms}.analyzers())
+	if err != nil {
+		t.Fatalf("parseQuery() error = %v", err)
+	}
+	if expected := `((auth OR login OR "sign in") -webhook)`; q.String() != expected {
+		t.Errorf("String() = %s, expected %s", q, expected)
+	}
+
+	var weights []float64
+	for _, term := range q.ScoringTerms() {
+		weights = append(weights, term.weight())
+	}
+	if expected := []float64{1, DefaultSynonymWeight, DefaultSynonymWeight}; !reflect.DeepEqual(weights, expected) {
+		t.Errorf("weights = %v, expected %v", weights, expected)
+	}
+}
+
+func TestParseQuery_MultiWordSynonyms(t *testing.T) {
+	synonyms := NewSynonyms()
+	synonyms.AddGroup("auth", "login", "sign in")
+	synonyms.Add("api key", "credentials")
+	synonyms.Add("api key rotation", "rekeying")
+	analysis := Options{Synonyms: synonyms}.analyzers()
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		// Unquoted words with synonyms as a phrase still match on their own
+		{"sign in", "(sign OR auth OR login)"},
+		{"how to sign in", "(how (sign OR auth OR login))"},
+		{"api key rotation", "((api key rotation) OR rekeying)"},
+		{"api key", "((api key) OR credentials)"},
+		{"api +key", "(+key api)"},
+		{"sign", "sign"},
+	}
+	for _, tt := range tests {
+		q, err := parseQuery(tt.query, analysis)
+		if err != nil {
+			t.Fatalf("parseQuery(%q) error = %v", tt.query, err)
+		}
+		if q.String() != tt.expected {
+			t.Errorf("parseQuery(%q) = %s, expected %s", tt.query, q, tt.expected)
+		}
+	}
+}
+
+func TestFindRelevantFiles_Synonyms(t *testing.T) {
+	testFS := fstest.MapFS{
+		"auth.md":     &fstest.MapFile{Data: []byte("# Auth\n\nSend the auth header.")},
+		"sessions.md": &fstest.MapFile{Data: []byte("# Sessions\n\nSign in with your email.")},
+		"webhooks.md": &fstest.MapFile{Data: []byte("# Webhooks\n\nEvents are sent to your server.")},
+	}
+	synonyms := NewSynonyms()
+	synonyms.AddGroup("auth", "login", "sign in")
+	opts := Options{Synonyms: synonyms}
+
+	indexed, err := NewIndexedSearchEngineWithOptions(testFS, opts)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngineWithOptions() error = %v", err)
+	}
+
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngineWithOptions(testFS, opts), "index": indexed} {
+		results, err := engine.FindRelevantFiles("auth", 10)
+		if err != nil {
+			t.Fatalf("FindRelevantFiles() error = %v", err)
+		}
+		if len(results) != 2 || results[0].Path != "auth.md" || results[1].Path != "sessions.md" {
+			t.Fatalf("%s: FindRelevantFiles() = %v, expected auth.md then sessions.md", name, results)
+		}
+		if !strings.Contains(results[1].Reason, "synonym match 'auth'→'sign in'") {
+			t.Errorf("%s: reason %q should show the synonym", name, results[1].Reason)
+		}
+		if strings.Contains(results[0].Reason, "synonym") {
+			t.Errorf("%s: reason %q should not show a synonym", name, results[0].Reason)
+		}
+
+		// The phrase doesn't need quotes to reach its synonyms
+		results, err = engine.FindRelevantFiles("sign in", 10)
+		if err != nil {
+			t.Fatalf("FindRelevantFiles() error = %v", err)
+		}
+		if len(results) != 2 || results[0].Path != "auth.md" || !strings.Contains(results[0].Reason, "synonym match 'sign in'→'auth'") {
+			t.Errorf("%s: FindRelevantFiles(sign in) = %v, expected auth.md through its synonym", name, results)
+		}
+	}
+}
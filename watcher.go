@@ -0,0 +1,104 @@
+package search_engine
+
+import (
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often a Watcher polls when no interval is given
+const DefaultWatchInterval = time.Second
+
+// Watcher keeps an index in sync with a filesystem by polling it. Created,
+// edited and removed files are applied with Index.Update; a renamed file shows
+// up as removed under its old path and added under the new one.
+//
+// Each poll swaps the new state in atomically, so queries running on the index
+// see either the state before or after a poll, never a mix of both.
+type Watcher struct {
+	fs       fs.FS
+	index    *Index
+	interval time.Duration
+
+	// OnUpdate, when set, is called after every poll that changed the index
+	OnUpdate func(IndexUpdate)
+	// OnError, when set, is called when a poll fails
+	OnError func(error)
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewWatcher creates a watcher that applies changes in filesystem to index
+func NewWatcher(filesystem fs.FS, index *Index, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	return &Watcher{
+		fs:       filesystem,
+		index:    index,
+		interval: interval,
+	}
+}
+
+// Start begins polling in the background. It does nothing if the watcher is already running.
+func (w *Watcher) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stop != nil {
+		return
+	}
+
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.run(w.stop, w.done)
+}
+
+// Stop stops polling and waits for a poll in progress to finish
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stop == nil {
+		return
+	}
+
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+	w.done = nil
+}
+
+// Poll checks the filesystem once and applies any change to the index
+func (w *Watcher) Poll() (IndexUpdate, error) {
+	update, err := w.index.Update(w.fs)
+	if err != nil {
+		if w.OnError != nil {
+			w.OnError(err)
+		}
+		return update, err
+	}
+
+	if !update.Empty() && w.OnUpdate != nil {
+		w.OnUpdate(update)
+	}
+	return update, nil
+}
+
+func (w *Watcher) run(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.Poll()
+		}
+	}
+}
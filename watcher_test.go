@@ -0,0 +1,64 @@
+package search_engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher_AppliesChanges(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("setup.md", "Setup instructions")
+	write("old.md", "Legacy webhooks")
+
+	engine, err := NewIndexedSearchEngine(os.DirFS(dir))
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+
+	updates := make(chan IndexUpdate, 10)
+	watcher := NewWatcher(os.DirFS(dir), engine.Index(), 10*time.Millisecond)
+	watcher.OnUpdate = func(update IndexUpdate) { updates <- update }
+	watcher.Start()
+	defer watcher.Stop()
+
+	write("billing.md", "Billing and invoices")
+	if err := os.Rename(filepath.Join(dir, "old.md"), filepath.Join(dir, "webhooks.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := map[string]bool{}
+	timeout := time.After(5 * time.Second)
+	for !changed["billing.md"] || !changed["webhooks.md"] || !changed["old.md"] {
+		select {
+		case update := <-updates:
+			for _, path := range append(append(update.Added, update.Modified...), update.Removed...) {
+				changed[path] = true
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for updates, got %v", changed)
+		}
+	}
+
+	results, err := engine.FindRelevantFiles("billing", 5)
+	if err != nil {
+		t.Fatalf("FindRelevantFiles() error = %v", err)
+	}
+	if len(results) == 0 || results[0].Path != "billing.md" {
+		t.Errorf("Expected billing.md after the update, got %v", results)
+	}
+
+	if _, ok := engine.Index().Document("old.md"); ok {
+		t.Errorf("Renamed file is still indexed under its old path")
+	}
+	if _, ok := engine.Index().Document("webhooks.md"); !ok {
+		t.Errorf("Renamed file is not indexed under its new path")
+	}
+}
@@ -0,0 +1,137 @@
+package search_engine
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultMaxExpansions is the number of dictionary terms a wildcard or fuzzy
+// term expands to when Options doesn't set a limit
+const DefaultMaxExpansions = 50
+
+// WildcardNode matches the dictionary terms that fit a pattern, where * stands
+// for any number of characters and ? for exactly one
+type WildcardNode struct {
+	Text    string // The pattern as written in the query
+	Pattern string // Lowercased pattern
+
+	// Expansions are the dictionary terms matching the pattern, filled in by the
+	// engine before the query is evaluated. Truncated is set when there were
+	// more than the expansion limit.
+	Expansions []string
+	Truncated  bool
+}
+
+func (n *WildcardNode) String() string { return n.Pattern }
+
+func (n *WildcardNode) matches(doc *Document) bool {
+	return doc.containsAnyTerm(n.Expansions, nil)
+}
+
+func (n *WildcardNode) collectTerms(positive, negative *[]QueryTerm, negated bool) {
+	var terms []QueryTerm
+	for _, exp := range n.Expansions {
+		terms = append(terms, QueryTerm{Text: exp, Expansion: "wildcard", Original: n.Pattern})
+	}
+
+	if negated {
+		*negative = append(*negative, terms...)
+	} else {
+		*positive = append(*positive, terms...)
+	}
+}
+
+// expand fills in the expansions from a sorted term dictionary, keeping the
+// first limit terms in dictionary order
+func (n *WildcardNode) expand(dictionary []string, limit int) {
+	n.Expansions, n.Truncated = nil, false
+
+	// Terms sharing the literal prefix of the pattern are contiguous in the dictionary
+	prefix := n.Pattern[:strings.IndexAny(n.Pattern, "*?")]
+	for _, term := range dictionary[sort.SearchStrings(dictionary, prefix):] {
+		if !strings.HasPrefix(term, prefix) {
+			break
+		}
+		if !wildcardMatch(n.Pattern, term) {
+			continue
+		}
+		if len(n.Expansions) == limit {
+			n.Truncated = true
+			break
+		}
+		n.Expansions = append(n.Expansions, term)
+	}
+}
+
+// isWildcard reports whether a query word is a wildcard pattern. A single
+// question mark at the end is punctuation, as in "how to paginate?".
+func isWildcard(word string) bool {
+	if strings.Contains(word, "*") {
+		return true
+	}
+	return strings.Contains(strings.TrimSuffix(word, "?"), "?")
+}
+
+// wildcardNode parses a wildcard pattern. The tokenizer splits words at
+// punctuation, so a pattern such as api_?ates becomes the AND of its parts.
+// Parts without wildcards are analyzed like any other query word.
+func wildcardNode(word string, queryAnalyzer Analyzer) Node {
+	parts := strings.FieldsFunc(strings.ToLower(word), func(r rune) bool {
+		return !isWordRune(r) && r != '*' && r != '?'
+	})
+
+	var children []Node
+	for _, part := range parts {
+		if !strings.ContainsAny(part, "*?") {
+			if terms := analyzeTerms(queryAnalyzer, part); len(terms) > 0 {
+				children = append(children, &TermNode{Text: part, Terms: terms[:1]})
+			}
+			continue
+		}
+		if strings.Trim(part, "*?") == "" {
+			continue // Patterns without any letter would match every term
+		}
+		children = append(children, &WildcardNode{Text: part, Pattern: part})
+	}
+
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		if wildcard, ok := children[0].(*WildcardNode); ok {
+			wildcard.Text = word
+		}
+		return children[0]
+	}
+	return &AndNode{Children: children}
+}
+
+// wildcardMatch reports whether s matches a pattern of literal characters, *
+// and ?
+func wildcardMatch(pattern, s string) bool {
+	p, t := []rune(pattern), []rune(s)
+	pi, ti := 0, 0
+	star, mark := -1, 0
+
+	for ti < len(t) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == t[ti]):
+			pi++
+			ti++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ti
+			pi++
+		case star >= 0:
+			// Let the last star absorb one more character
+			mark++
+			pi, ti = star+1, mark
+		default:
+			return false
+		}
+	}
+
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
@@ -0,0 +1,164 @@
+package search_engine
+
+import (
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		term     string
+		expected bool
+	}{
+		{"vouch*", "voucher", true},
+		{"vouch*", "vouch", true},
+		{"vouch*", "avouch", false},
+		{"*transaction", "vouchertransaction", true},
+		{"*transaction", "transactions", false},
+		{"?ates", "dates", true},
+		{"?ates", "ates", false},
+		{"p*n*n", "pagination", true},
+		{"a*b*c", "abxbc", true},
+		{"a*b*c", "abxbd", false},
+	}
+
+	for _, tt := range tests {
+		if got := wildcardMatch(tt.pattern, tt.term); got != tt.expected {
+			t.Errorf("wildcardMatch(%q, %q) = %v, expected %v", tt.pattern, tt.term, got, tt.expected)
+		}
+	}
+}
+
+func TestParseQuery_Wildcards(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"Vouch*", "vouch*"},
+		{"*Transaction", "*transaction"},
+		{"api_?ates", "(api AND ?ates)"},
+		{"how to paginate?", "(how paginate?)"},
+		{"***", ""},
+	}
+
+	for _, tt := range tests {
+		q, _ := ParseQuery(tt.query)
+		if got := q.String(); got != tt.expected {
+			t.Errorf("ParseQuery(%q) = %s, expected %s", tt.query, got, tt.expected)
+		}
+	}
+}
+
+func TestWildcardNode_Expand(t *testing.T) {
+	dictionary := []string{"api", "transaction", "voucher", "voucherproduct", "vouchers", "vouchertransaction"}
+
+	n := &WildcardNode{Pattern: "vouch*"}
+	n.expand(dictionary, 10)
+	if expected := []string{"voucher", "voucherproduct", "vouchers", "vouchertransaction"}; !reflect.DeepEqual(n.Expansions, expected) || n.Truncated {
+		t.Errorf("Expansions = %v (truncated %v), expected %v", n.Expansions, n.Truncated, expected)
+	}
+
+	n = &WildcardNode{Pattern: "*transaction"}
+	n.expand(dictionary, 1)
+	if expected := []string{"transaction"}; !reflect.DeepEqual(n.Expansions, expected) || !n.Truncated {
+		t.Errorf("Expansions = %v (truncated %v), expected %v cut short", n.Expansions, n.Truncated, expected)
+	}
+}
+
+func TestFindRelevantFiles_Wildcards(t *testing.T) {
+	tests := []struct {
+		query  string
+		opts   Options
+		first  string
+		reason string
+	}{
+		{"vouch*", Options{}, "vouchers.md", "wildcard match 'vouch*'→'voucher'/"},
+		{"*Transaction", Options{}, "vouchers.md", "'vouchertransaction'"},
+		{"api_?ates", Options{}, "api_dates.md", "wildcard match '?ates'→'dates'"},
+		{"vouch*", Options{MaxExpansions: 1}, "vouchers.md", "'vouch*' cut short at 1 terms"},
+	}
+
+	for _, tt := range tests {
+		engines := map[string]SearchEngine{"scan": NewSearchEngineWithOptions(os.DirFS("testData"), tt.opts)}
+		indexed, err := NewIndexedSearchEngineWithOptions(os.DirFS("testData"), tt.opts)
+		if err != nil {
+			t.Fatalf("NewIndexedSearchEngineWithOptions() error = %v", err)
+		}
+		engines["indexed"] = indexed
+
+		for name, engine := range engines {
+			results, err := engine.FindRelevantFiles(tt.query, 10)
+			if err != nil {
+				t.Fatalf("%s: FindRelevantFiles(%q) error = %v", name, tt.query, err)
+			}
+			if len(results) == 0 {
+				t.Errorf("%s: FindRelevantFiles(%q) found nothing", name, tt.query)
+				continue
+			}
+			if results[0].Path != tt.first {
+				t.Errorf("%s: FindRelevantFiles(%q) first = %s, expected %s", name, tt.query, results[0].Path, tt.first)
+			}
+			if !strings.Contains(results[0].Reason, tt.reason) {
+				t.Errorf("%s: reason %q should contain %q", name, results[0].Reason, tt.reason)
+			}
+		}
+	}
+}
+
+func TestFindRelevantFiles_OnlyWildcardsMatchPartially(t *testing.T) {
+	testFS := fstest.MapFS{
+		"api.md":    &fstest.MapFile{Data: []byte("# API\nThe api.")},
+		"apiary.md": &fstest.MapFile{Data: []byte("# Bees\nKeeping bees.")},
+		"tags.md":   &fstest.MapFile{Data: []byte("# Tags\nWill assign this tag.")},
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{`"the api"`, []string{"api.md"}},
+		{"apiculture", nil}, // Contains api, but only a wildcard would match it
+		{"apia*", []string{"apiary.md"}},
+		{"sign", nil}, // Inside assign
+		{"+sign", nil},
+		{"*sign", []string{"tags.md"}},
+	}
+	indexed, err := NewIndexedSearchEngine(testFS)
+	if err != nil {
+		t.Fatalf("NewIndexedSearchEngine() error = %v", err)
+	}
+	for name, engine := range map[string]SearchEngine{"scan": NewSearchEngine(testFS), "index": indexed} {
+		for _, tt := range tests {
+			results, err := engine.FindRelevantFiles(tt.query, 10)
+			if err != nil {
+				t.Fatalf("%s: FindRelevantFiles(%q) error = %v", name, tt.query, err)
+			}
+			var paths []string
+			for _, result := range results {
+				if strings.Contains(result.Reason, "partial") {
+					t.Errorf("%s: FindRelevantFiles(%q) = %v, expected no partial match", name, tt.query, result)
+				}
+				paths = append(paths, result.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("%s: FindRelevantFiles(%q) = %v, expected %v", name, tt.query, paths, tt.expected)
+			}
+		}
+	}
+
+	// Snippets don't count the words a term is only part of
+	matches, err := NewSearchEngine(testFS).ExtractContentMatches("tags.md", "sign tag", 0)
+	if err != nil {
+		t.Fatalf("ExtractContentMatches() error = %v", err)
+	}
+	for _, m := range matches {
+		if slices.Contains(m.Terms, "sign") {
+			t.Errorf("ExtractContentMatches() = %+v, expected sign not to match assign", m)
+		}
+	}
+}